@@ -0,0 +1,189 @@
+// Package client is a Go SDK of the vote server. It wraps the HTTP routes and
+// the host and player websocket protocols with typed methods, for integration
+// tests, bots and tooling.
+//
+//	c, _ := client.New("http://localhost:8080")
+//	host, _ := c.CreateRoom(ctx, room.CreateRoomAPIRequest{...})
+//	player, _ := c.JoinRoom(ctx, host.RoomID, "uid", "name", client.JoinOptions{Passcode: host.Passcode})
+//	host.StartRound(ctx)
+//	player.Vote(ctx, player.Candidates()[0].ID)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"main/internal/controller/room"
+)
+
+// _protocolVersion is the websocket protocol version spoken by the client.
+const _protocolVersion = 1
+
+// _requestTimeout bounds the requests made with a context without deadline.
+const _requestTimeout = 10 * time.Second
+
+// Client calls the routes of a vote server.
+type Client struct {
+	base *url.URL
+	http *http.Client
+}
+
+// New returns a client of the server at baseURL, such as http://localhost:8080.
+func New(baseURL string) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", base.Scheme)
+	}
+
+	return &Client{base: base, http: &http.Client{Timeout: _requestTimeout}}, nil
+}
+
+// HTTPError is returned for replies with a non 2xx status. Err is the error
+// body of the REST API, nil for the routes replying plain text.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+	Err        *room.Error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Err.Error())
+	}
+
+	if len(e.Body) != 0 {
+		return fmt.Sprintf("status %d: %s", e.StatusCode, e.Body)
+	}
+
+	return fmt.Sprintf("status %d: %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap lets errors.As find the *room.Error of REST API replies.
+func (e *HTTPError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+
+	return e.Err
+}
+
+// CreateRoom creates a room through the REST API and returns its host. The UID
+// of the request is optional, the server generates one when it is empty.
+func (c *Client) CreateRoom(ctx context.Context, request room.CreateRoomAPIRequest) (*Host, error) {
+	var response room.CreateRoomResponse
+	if err := c.do(ctx, c.http, http.MethodPost, "/api/rooms", "", request, &response); err != nil {
+		return nil, err
+	}
+
+	h := c.Host(response.RoomID, response.HostToken)
+	h.Passcode = response.Passcode
+
+	return h, nil
+}
+
+// Receipts returns the voter receipts of a finished game.
+func (c *Client) Receipts(ctx context.Context, roomID string) (*room.ReceiptsResponse, error) {
+	var response room.ReceiptsResponse
+	if err := c.do(ctx, c.http, http.MethodGet, "/api/vote/"+url.PathEscape(roomID)+"/receipts", "", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// do sends a request with body encoded as JSON, and decodes the reply into
+// response when it is not nil. The host token is sent as a bearer token.
+func (c *Client) do(ctx context.Context, hc *http.Client, method, path, token string, body, response any) error {
+	reply, err := c.send(ctx, hc, method, path, token, body)
+	if err != nil {
+		return err
+	}
+
+	if response == nil || len(reply) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(reply, response)
+}
+
+// send sends a request and returns the body of a 2xx reply.
+func (c *Client) send(ctx context.Context, hc *http.Client, method, path, token string, body any) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.base.String()+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if len(token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	reply, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newHTTPError(resp, reply)
+	}
+
+	return reply, nil
+}
+
+func newHTTPError(resp *http.Response, body []byte) error {
+	e := &HTTPError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var apiErr room.Error
+		if err := json.Unmarshal(body, &apiErr); err == nil && len(apiErr.Code) != 0 {
+			e.Err = &apiErr
+		}
+	}
+
+	return e
+}
+
+// wsURL returns the websocket URL of path.
+func (c *Client) wsURL(path string) string {
+	u := *c.base
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	return u.String() + path
+}
+
+// errClosed is returned by the requests of a closed connection.
+var errClosed = errors.New("connection closed")
@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"main/internal/controller/room"
+	"main/internal/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// _eventBufferSize is the number of events buffered for a connection. Events
+// are dropped when the buffer is full, the state of the connection is kept up
+// to date either way.
+const _eventBufferSize = 256
+
+// conn is a websocket connection exchanging messages of type M, replies are
+// matched to requests by their request ID.
+type conn[M any] struct {
+	ws        *websocket.Conn
+	writeMu   sync.Mutex
+	ids       atomic.Int64
+	pending   *utils.SyncMap[string, chan M]
+	events    chan M
+	dropped   atomic.Int64
+	done      chan struct{}
+	err       error
+	closed    atomic.Bool
+	closeOnce sync.Once
+
+	// requestID returns the request ID of a message, empty for pushed messages.
+	requestID func(M) string
+	// handle applies a message to the state of the connection, before it is
+	// replied to a request or sent as an event.
+	handle func(M)
+}
+
+func dial[M any](ctx context.Context, dialer *websocket.Dialer, url string, header http.Header, requestID func(M) string, handle func(M)) (*conn[M], error) {
+	ws, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		if resp != nil {
+			return nil, &HTTPError{StatusCode: resp.StatusCode, Body: http.StatusText(resp.StatusCode)}
+		}
+
+		return nil, err
+	}
+
+	c := &conn[M]{
+		ws:        ws,
+		pending:   utils.NewSyncMap[string, chan M](),
+		events:    make(chan M, _eventBufferSize),
+		done:      make(chan struct{}),
+		requestID: requestID,
+		handle:    handle,
+	}
+
+	return c, nil
+}
+
+// read handles the messages received until the connection is closed. It is
+// started by the owner of the connection once it is ready to handle them.
+func (c *conn[M]) read() {
+	defer func() {
+		close(c.done)
+		close(c.events)
+	}()
+
+	for {
+		var msg M
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			c.err = err
+			return
+		}
+
+		c.handle(msg)
+
+		if id := c.requestID(msg); len(id) != 0 {
+			if reply, ok := c.pending.Load(id); ok {
+				select {
+				case reply <- msg:
+				default:
+				}
+			}
+		}
+
+		select {
+		case c.events <- msg:
+		default:
+			c.dropped.Add(1)
+		}
+	}
+}
+
+// request sends the message built with a new request ID and waits for its reply.
+func (c *conn[M]) request(ctx context.Context, build func(requestID string) any) (M, error) {
+	var zero M
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, _requestTimeout)
+		defer cancel()
+	}
+
+	id := strconv.FormatInt(c.ids.Add(1), 10)
+	reply := make(chan M, 1)
+	c.pending.Store(id, reply)
+	defer c.pending.Delete(id)
+
+	if err := c.write(build(id)); err != nil {
+		return zero, err
+	}
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-c.done:
+		return zero, c.Err()
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func (c *conn[M]) write(msg any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.ws.WriteJSON(msg)
+}
+
+// Dropped returns the number of events dropped because Events was not read
+// fast enough.
+func (c *conn[M]) Dropped() int64 {
+	return c.dropped.Load()
+}
+
+// Done is closed once the connection is closed.
+func (c *conn[M]) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error which closed the connection once Done is closed, nil
+// before.
+func (c *conn[M]) Err() error {
+	select {
+	case <-c.done:
+	default:
+		return nil
+	}
+
+	if c.err == nil || c.closed.Load() {
+		return errClosed
+	}
+
+	return c.err
+}
+
+// Close closes the connection.
+func (c *conn[M]) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.closed.Store(true)
+		c.writeMu.Lock()
+		c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		c.writeMu.Unlock()
+		err = c.ws.Close()
+	})
+
+	return err
+}
+
+// dashboard tracks the dashboard of a room from its snapshots and deltas.
+type dashboard struct {
+	mu         sync.Mutex
+	seq        int64
+	candidates map[string]*room.Candidate
+	limit      int
+}
+
+func newDashboard() *dashboard {
+	return &dashboard{candidates: map[string]*room.Candidate{}}
+}
+
+// snapshot replaces the dashboard, unless seq is older than the tracked one.
+func (d *dashboard) snapshot(candidates []*room.Candidate, seq int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if seq < d.seq {
+		return
+	}
+
+	d.seq = seq
+	d.candidates = make(map[string]*room.Candidate, len(candidates))
+	for _, c := range candidates {
+		cp := *c
+		d.candidates[c.ID] = &cp
+	}
+}
+
+// delta applies the changed candidates of seq. It returns false when deltas
+// were missed, and the dashboard needs a snapshot to catch up.
+func (d *dashboard) delta(candidates []*room.Candidate, seq int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if seq <= d.seq {
+		return true
+	}
+
+	if seq != d.seq+1 {
+		return false
+	}
+
+	d.seq = seq
+	for _, c := range candidates {
+		cp := *c
+		d.candidates[c.ID] = &cp
+	}
+
+	return true
+}
+
+// get returns the dashboard sorted like the server does, and its sequence number.
+func (d *dashboard) get() ([]*room.Candidate, int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]*room.Candidate, 0, len(d.candidates))
+	for _, c := range d.candidates {
+		cp := *c
+		result = append(result, &cp)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+
+		return result[i].Order < result[j].Order
+	})
+
+	if d.limit > 0 && d.limit < len(result) {
+		result = result[:d.limit]
+	}
+
+	return result, d.seq
+}
+
+func (d *dashboard) clone() *dashboard {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	c := &dashboard{seq: d.seq, candidates: make(map[string]*room.Candidate, len(d.candidates)), limit: d.limit}
+	for id, candidate := range d.candidates {
+		cp := *candidate
+		c.candidates[id] = &cp
+	}
+
+	return c
+}
+
+func (d *dashboard) setLimit(limit int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.limit = limit
+}
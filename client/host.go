@@ -0,0 +1,303 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"main/internal/controller/room"
+
+	"github.com/gorilla/websocket"
+)
+
+// Host drives a room with its host token.
+type Host struct {
+	c        *Client
+	RoomID   string
+	Token    string
+	Passcode string
+}
+
+// Host returns the host of an existing room.
+func (c *Client) Host(roomID, token string) *Host {
+	return &Host{c: c, RoomID: roomID, Token: token}
+}
+
+func (h *Host) path(suffix string) string {
+	return "/api/rooms/" + url.PathEscape(h.RoomID) + suffix
+}
+
+func (h *Host) do(ctx context.Context, method, suffix string, body, response any) error {
+	return h.c.do(ctx, h.c.http, method, h.path(suffix), h.Token, body, response)
+}
+
+// Room returns the room.
+func (h *Host) Room(ctx context.Context) (*room.RoomResponse, error) {
+	var response room.RoomResponse
+	if err := h.do(ctx, http.MethodGet, "", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// SetGame adds or renames the candidates and changes the settings of the room.
+func (h *Host) SetGame(ctx context.Context, settings room.GameSettings) (*room.RoomResponse, error) {
+	var response room.RoomResponse
+	if err := h.do(ctx, http.MethodPut, "/game", settings, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// StartRound starts the next round.
+func (h *Host) StartRound(ctx context.Context) (*room.RoundResponse, error) {
+	return h.round(ctx, "/rounds", room.StartRoundRequest{})
+}
+
+// StopRound stops the running round before its countdown is over.
+func (h *Host) StopRound(ctx context.Context) (*room.RoundResponse, error) {
+	return h.round(ctx, "/rounds/stop", nil)
+}
+
+// EndGame ends the game and publishes the results.
+func (h *Host) EndGame(ctx context.Context) (*room.RoundResponse, error) {
+	return h.round(ctx, "/end", nil)
+}
+
+func (h *Host) round(ctx context.Context, suffix string, body any) (*room.RoundResponse, error) {
+	var response room.RoundResponse
+	if err := h.do(ctx, http.MethodPost, suffix, body, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Dashboard returns the dashboard of the room.
+func (h *Host) Dashboard(ctx context.Context) (*room.DashboardResponse, error) {
+	var response room.DashboardResponse
+	if err := h.do(ctx, http.MethodGet, "/dashboard", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Players lists the players of the room.
+func (h *Host) Players(ctx context.Context) (*room.PlayersResponse, error) {
+	var response room.PlayersResponse
+	if err := h.do(ctx, http.MethodGet, "/players", nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Results returns the results of the finished game, with pseudonyms for the
+// voters when anonymize is true.
+func (h *Host) Results(ctx context.Context, anonymize bool) (*room.Results, error) {
+	suffix := "/results"
+	if anonymize {
+		suffix += "?anonymize=true"
+	}
+
+	var response room.Results
+	if err := h.do(ctx, http.MethodGet, suffix, nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// Export returns the results of the finished game in format (json, csv or md).
+// Table picks the CSV table, and is ignored by the other formats.
+func (h *Host) Export(ctx context.Context, format, table string, anonymize bool) ([]byte, error) {
+	query := url.Values{}
+	query.Set("format", format)
+	if len(table) != 0 {
+		query.Set("table", table)
+	}
+
+	if anonymize {
+		query.Set("anonymize", "true")
+	}
+
+	path := "/api/vote/" + url.PathEscape(h.RoomID) + "/export?" + query.Encode()
+
+	return h.c.send(ctx, h.c.http, http.MethodGet, path, h.Token, nil)
+}
+
+// Webhooks returns the webhooks of the room and their delivery log.
+func (h *Host) Webhooks(ctx context.Context) (*room.WebhooksResponse, error) {
+	var response room.WebhooksResponse
+	path := "/api/vote/" + url.PathEscape(h.RoomID) + "/webhooks"
+	if err := h.c.do(ctx, h.c.http, http.MethodGet, path, h.Token, nil, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// HostConn is a host websocket connection. It tracks the round, players and
+// dashboard of the room, and sends every message received as an event.
+type HostConn struct {
+	*conn[room.HostWsMessageOutgoing]
+
+	dashboard *dashboard
+
+	mu       sync.Mutex
+	round    int
+	endTime  int64
+	gameOver bool
+	players  []string
+}
+
+// Connect opens the host websocket of the room, and returns once the state of
+// the room is received.
+func (h *Host) Connect(ctx context.Context) (*HostConn, error) {
+	hc := &HostConn{dashboard: newDashboard()}
+
+	path := "/api/vote/" + url.PathEscape(h.RoomID) + "/" + url.PathEscape(h.RoomID) + "/host"
+	header := http.Header{"Authorization": {"Bearer " + h.Token}}
+	requestID := func(msg room.HostWsMessageOutgoing) string { return msg.RequestID }
+	c, err := dial(ctx, &websocket.Dialer{}, h.c.wsURL(path), header, requestID, hc.handle)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.conn = c
+	go c.read()
+
+	if err := hc.command(ctx, room.HostWsMessageIncoming{Type: room.MessageTypeConnect, Connect: true}); err != nil {
+		c.Close()
+
+		return nil, err
+	}
+
+	return hc, nil
+}
+
+// Events returns the messages received, closed once the connection is closed.
+func (hc *HostConn) Events() <-chan room.HostWsMessageOutgoing {
+	return hc.events
+}
+
+// SetGame adds or renames the candidates and changes the settings of the room.
+func (hc *HostConn) SetGame(ctx context.Context, settings room.GameSettings) error {
+	return hc.command(ctx, room.HostWsMessageIncoming{Type: room.MessageTypeSetGame, SetGame: &settings})
+}
+
+// StartRound starts the round after the one tracked by the connection.
+func (hc *HostConn) StartRound(ctx context.Context) error {
+	return hc.command(ctx, room.HostWsMessageIncoming{
+		Type:  room.MessageTypeRound,
+		Round: &room.RoundCommand{Round: hc.Round(), Start: true},
+	})
+}
+
+// EndGame ends the game and publishes the results.
+func (hc *HostConn) EndGame(ctx context.Context) error {
+	return hc.command(ctx, room.HostWsMessageIncoming{
+		Type:  room.MessageTypeRound,
+		Round: &room.RoundCommand{Round: hc.Round(), GameOver: true},
+	})
+}
+
+// command sends msg and waits for its reply, a rejected command returns the
+// *room.Error replied.
+func (hc *HostConn) command(ctx context.Context, msg room.HostWsMessageIncoming) error {
+	reply, err := hc.request(ctx, func(requestID string) any {
+		msg.Version = _protocolVersion
+		msg.RequestID = requestID
+
+		return msg
+	})
+	if err != nil {
+		return err
+	}
+
+	if reply.Error != nil {
+		return reply.Error
+	}
+
+	return nil
+}
+
+// Round returns the current round.
+func (hc *HostConn) Round() int {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	return hc.round
+}
+
+// EndTime returns the end time of the countdown of the current round, in unix milliseconds.
+func (hc *HostConn) EndTime() int64 {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	return hc.endTime
+}
+
+// GameOver reports whether the game is over.
+func (hc *HostConn) GameOver() bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	return hc.gameOver
+}
+
+// Players returns the names of the players online.
+func (hc *HostConn) Players() []string {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	return append([]string(nil), hc.players...)
+}
+
+// Dashboard returns the dashboard and its sequence number.
+func (hc *HostConn) Dashboard() ([]*room.Candidate, int64) {
+	return hc.dashboard.get()
+}
+
+func (hc *HostConn) handle(msg room.HostWsMessageOutgoing) {
+	hc.mu.Lock()
+	switch {
+	case msg.Connect != nil:
+		hc.round, hc.endTime, hc.gameOver = msg.Connect.Round, msg.Connect.EndTime, msg.Connect.GameOver
+		hc.players = msg.Connect.Player
+	case msg.Round != nil:
+		// HINT: zero values keep the tracked state like host.html does.
+		if msg.Round.Round != 0 {
+			hc.round = msg.Round.Round
+		}
+
+		if msg.Round.EndTime != 0 {
+			hc.endTime = msg.Round.EndTime
+		}
+
+		hc.gameOver = hc.gameOver || msg.Round.GameOver
+	case msg.Dashboard != nil:
+		hc.gameOver = hc.gameOver || msg.Dashboard.GameOver
+	case msg.DashboardDelta != nil:
+		hc.gameOver = hc.gameOver || msg.DashboardDelta.GameOver
+	case msg.Player != nil:
+		hc.players = msg.Player.Player
+	}
+	hc.mu.Unlock()
+
+	switch {
+	case msg.Connect != nil:
+		hc.dashboard.snapshot(msg.Connect.Dashboard, msg.Connect.Seq)
+	case msg.Dashboard != nil:
+		hc.dashboard.snapshot(msg.Dashboard.Dashboard, msg.Dashboard.Seq)
+	case msg.DashboardDelta != nil:
+		if !hc.dashboard.delta(msg.DashboardDelta.Candidates, msg.DashboardDelta.Seq) {
+			// HINT: deltas were missed, a connect command replies a snapshot.
+			hc.write(room.HostWsMessageIncoming{Version: _protocolVersion, Type: room.MessageTypeConnect, Connect: true})
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+
+	"main/internal/controller/room"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// JoinOptions are the credentials a room may require to join it.
+type JoinOptions struct {
+	Passcode string
+	Invite   string
+}
+
+// Player is a player websocket connection. It tracks the candidates, round,
+// dashboard and receipts of the room, and sends every message received as an
+// event.
+type Player struct {
+	*conn[room.PlayerWsMessageOutgoing]
+
+	c         *Client
+	http      *http.Client
+	RoomID    string
+	UID       string
+	dashboard *dashboard
+
+	mu          sync.Mutex
+	name        string
+	candidates  []*room.Candidate
+	round       int
+	endTime     int64
+	gameOver    bool
+	voted       string
+	receipt     string
+	resumeToken string
+	receipts    []room.Receipt
+}
+
+// JoinRoom joins the room as player uid, and returns once the state of the
+// room is received. Every player has its own session cookie, rooms requiring
+// a login can't be joined.
+func (c *Client) JoinRoom(ctx context.Context, roomID, uid, name string, opts JoinOptions) (*Player, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := *c.http
+	hc.Jar = jar
+
+	request := room.CreatePlayerRequest{Name: name, Passcode: opts.Passcode, Invite: opts.Invite}
+	path := "/api/vote/" + url.PathEscape(roomID) + "/" + url.PathEscape(uid)
+	if err := c.do(ctx, &hc, http.MethodPost, path, "", request, nil); err != nil {
+		return nil, err
+	}
+
+	p := newPlayer(c, &hc, roomID, uid)
+	if err := p.open(ctx, room.PlayerWsMessageIncoming{Type: room.MessageTypeConnect, Connect: true}); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reconnect resumes the session of the player on a new connection, after the
+// connection was dropped. The state tracked so far is carried over.
+func (p *Player) Reconnect(ctx context.Context) (*Player, error) {
+	p.Close()
+
+	np := newPlayer(p.c, p.http, p.RoomID, p.UID)
+	np.dashboard = p.dashboard.clone()
+
+	p.mu.Lock()
+	np.name, np.candidates, np.round, np.endTime, np.gameOver = p.name, p.candidates, p.round, p.endTime, p.gameOver
+	np.voted, np.receipt, np.resumeToken, np.receipts = p.voted, p.receipt, p.resumeToken, p.receipts
+	resume := &room.PlayerWsMessageResumeIncoming{Token: p.resumeToken, Round: p.round}
+	p.mu.Unlock()
+
+	_, resume.Seq = np.dashboard.get()
+	if err := np.open(ctx, room.PlayerWsMessageIncoming{Type: room.MessageTypeResume, Resume: resume}); err != nil {
+		return nil, err
+	}
+
+	return np, nil
+}
+
+func newPlayer(c *Client, hc *http.Client, roomID, uid string) *Player {
+	return &Player{c: c, http: hc, RoomID: roomID, UID: uid, dashboard: newDashboard()}
+}
+
+// open dials the player websocket and sends the first command.
+func (p *Player) open(ctx context.Context, first room.PlayerWsMessageIncoming) error {
+	path := "/api/vote/" + url.PathEscape(p.RoomID) + "/" + url.PathEscape(p.UID) + "/player"
+	dialer := &websocket.Dialer{Jar: p.http.Jar}
+	requestID := func(msg room.PlayerWsMessageOutgoing) string { return msg.RequestID }
+	c, err := dial(ctx, dialer, p.c.wsURL(path), nil, requestID, p.handle)
+	if err != nil {
+		return err
+	}
+
+	p.conn = c
+	go c.read()
+
+	if _, err := p.command(ctx, first); err != nil {
+		c.Close()
+
+		return err
+	}
+
+	return nil
+}
+
+// Sync requests the state of the room again, such as the candidates added
+// after the player joined.
+func (p *Player) Sync(ctx context.Context) error {
+	_, err := p.command(ctx, room.PlayerWsMessageIncoming{Type: room.MessageTypeConnect, Connect: true})
+
+	return err
+}
+
+// Events returns the messages received, closed once the connection is closed.
+func (p *Player) Events() <-chan room.PlayerWsMessageOutgoing {
+	return p.events
+}
+
+// Vote votes for candidateID in the current round. Voting twice in a round
+// returns the room.ErrAlreadyVoted error.
+func (p *Player) Vote(ctx context.Context, candidateID string) (*room.Vote, error) {
+	return p.VoteRound(ctx, p.Round(), candidateID)
+}
+
+// VoteRound votes for candidateID in round.
+func (p *Player) VoteRound(ctx context.Context, round int, candidateID string) (*room.Vote, error) {
+	ack, err := p.command(ctx, room.PlayerWsMessageIncoming{
+		Type: room.MessageTypeVote,
+		Vote: &room.PlayerWsMessageVoteIncoming{VoteID: uuid.NewString(), Round: round, Candidate: candidateID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ack.Vote, nil
+}
+
+// command sends msg and waits for its reply, a rejected command returns the
+// *room.Error replied.
+func (p *Player) command(ctx context.Context, msg room.PlayerWsMessageIncoming) (*room.Ack, error) {
+	reply, err := p.request(ctx, func(requestID string) any {
+		msg.Version = _protocolVersion
+		msg.RequestID = requestID
+
+		return msg
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Error != nil {
+		return nil, reply.Error
+	}
+
+	if reply.Ack == nil {
+		return &room.Ack{}, nil
+	}
+
+	return reply.Ack, nil
+}
+
+// Name returns the name of the player.
+func (p *Player) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.name
+}
+
+// Candidates returns the candidates of the room.
+func (p *Player) Candidates() []*room.Candidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]*room.Candidate(nil), p.candidates...)
+}
+
+// Round returns the current round.
+func (p *Player) Round() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.round
+}
+
+// EndTime returns the end time of the countdown of the current round, in unix milliseconds.
+func (p *Player) EndTime() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.endTime
+}
+
+// GameOver reports whether the game is over.
+func (p *Player) GameOver() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.gameOver
+}
+
+// Voted returns the candidate voted in the current round and its receipt,
+// empty when the player didn't vote yet.
+func (p *Player) Voted() (string, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.voted, p.receipt
+}
+
+// Receipts returns the receipts published once the game is over.
+func (p *Player) Receipts() []room.Receipt {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]room.Receipt(nil), p.receipts...)
+}
+
+// ResumeToken returns the token resuming the session on a new connection.
+func (p *Player) ResumeToken() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.resumeToken
+}
+
+// Dashboard returns the dashboard, limited to the candidates displayed to
+// players, and its sequence number.
+func (p *Player) Dashboard() ([]*room.Candidate, int64) {
+	return p.dashboard.get()
+}
+
+func (p *Player) handle(msg room.PlayerWsMessageOutgoing) {
+	p.mu.Lock()
+	switch {
+	case msg.Connect != nil:
+		// HINT: set_game broadcasts a connect message without the player fields,
+		// zero values keep the tracked state like player.html does.
+		m := msg.Connect
+		if len(m.PlayerName) != 0 {
+			p.name = m.PlayerName
+		}
+
+		if len(m.ResumeToken) != 0 {
+			p.resumeToken = m.ResumeToken
+		}
+
+		if len(m.Candidates) != 0 {
+			p.candidates = m.Candidates
+		}
+
+		p.setRound(m.Round, m.EndTime, m.GameOver)
+		if len(m.RoundVoted) != 0 {
+			p.voted, p.receipt = m.RoundVoted, m.RoundReceipt
+		}
+
+		if m.DashboardLimit != 0 {
+			p.dashboard.setLimit(m.DashboardLimit)
+		}
+	case msg.Resume != nil:
+		m := msg.Resume
+		if m.Candidates != nil {
+			p.candidates = m.Candidates
+		}
+
+		p.resumeToken = m.ResumeToken
+		if m.Round != p.round {
+			p.voted, p.receipt = "", ""
+		}
+
+		p.round, p.endTime, p.gameOver = m.Round, m.EndTime, m.GameOver
+		if len(m.RoundVoted) != 0 {
+			p.voted, p.receipt = m.RoundVoted, m.RoundReceipt
+		}
+	case msg.Round != nil:
+		p.setRound(msg.Round.Round, msg.Round.EndTime, msg.Round.GameOver)
+	case msg.Dashboard != nil:
+		p.gameOver = p.gameOver || msg.Dashboard.GameOver
+	case msg.DashboardDelta != nil:
+		p.gameOver = p.gameOver || msg.DashboardDelta.GameOver
+	case msg.Receipts != nil:
+		p.receipts = msg.Receipts
+	case msg.Ack != nil && msg.Ack.Vote != nil:
+		if msg.Ack.Vote.Round == p.round {
+			p.voted, p.receipt = msg.Ack.Vote.Candidate, msg.Ack.Vote.Receipt
+		}
+	}
+	p.mu.Unlock()
+
+	switch {
+	case msg.Connect != nil:
+		p.dashboard.snapshot(msg.Connect.Dashboard, msg.Connect.Seq)
+	case msg.Resume != nil && msg.Resume.Dashboard != nil:
+		p.dashboard.snapshot(msg.Resume.Dashboard, msg.Resume.Seq)
+	case msg.Round != nil:
+		p.dashboard.snapshot(msg.Round.Dashboard, msg.Round.Seq)
+	case msg.Dashboard != nil:
+		p.dashboard.snapshot(msg.Dashboard.Dashboard, msg.Dashboard.Seq)
+	case msg.DashboardDelta != nil:
+		if !p.dashboard.delta(msg.DashboardDelta.Candidates, msg.DashboardDelta.Seq) {
+			// HINT: deltas were missed, a connect command replies a snapshot.
+			p.write(room.PlayerWsMessageIncoming{Version: _protocolVersion, Type: room.MessageTypeConnect, Connect: true})
+		}
+	}
+}
+
+// setRound updates the round, forgetting the vote of the previous round. Zero
+// values keep the tracked state, and a finished game stays over.
+func (p *Player) setRound(round int, endTime int64, gameOver bool) {
+	if round != 0 && round != p.round {
+		p.round = round
+		p.voted, p.receipt = "", ""
+	}
+
+	if endTime != 0 {
+		p.endTime = endTime
+	}
+
+	p.gameOver = p.gameOver || gameOver
+}
@@ -0,0 +1,76 @@
+// Command voteaudit verifies a vote audit log. It checks the hash chain, replays
+// the accepted votes and compares the recomputed dashboards with the recorded
+// tallies.
+//
+//	AUDIT_SECRET=... voteaudit audit.log
+//
+// AUDIT_SECRET is the audit.secret of the server which wrote the log, the key
+// of its hash chain.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"main/internal/audit"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: voteaudit <audit log>")
+		os.Exit(2)
+	}
+
+	file, err := os.Open(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	defer file.Close()
+
+	secret := os.Getenv("AUDIT_SECRET")
+	if len(secret) == 0 {
+		fmt.Fprintln(os.Stderr, "voteaudit: AUDIT_SECRET is not set, only a log written without audit.secret verifies")
+	}
+
+	report, err := audit.Verify(file, []byte(secret))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	fmt.Printf("entries: %d, accepted votes: %d, rejected votes: %d, voter identities: %d\n", report.Entries, report.Votes, report.Rejected, report.Identities)
+
+	rooms := make([]string, 0, len(report.Tally))
+	for roomID := range report.Tally {
+		rooms = append(rooms, roomID)
+	}
+	sort.Strings(rooms)
+
+	for _, roomID := range rooms {
+		fmt.Printf("room %s\n", roomID)
+
+		tally := report.Tally[roomID]
+		candidates := make([]string, 0, len(tally))
+		for candidate := range tally {
+			candidates = append(candidates, candidate)
+		}
+		sort.Strings(candidates)
+
+		for _, candidate := range candidates {
+			fmt.Printf("  %s: %d\n", candidate, tally[candidate])
+		}
+	}
+
+	if report.OK() {
+		fmt.Println("OK")
+		return
+	}
+
+	for _, problem := range report.Problems {
+		fmt.Println("MISMATCH", problem)
+	}
+
+	os.Exit(1)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"main/internal/controller/room"
+	"main/internal/webhook"
+
+	"gopkg.in/yaml.v3"
+)
+
+// roomConfig is the YAML file of a room, see room.example.yaml.
+type roomConfig struct {
+	UID                   string          `yaml:"uid"`
+	Title                 string          `yaml:"title"`
+	Passcode              bool            `yaml:"passcode"`
+	InviteTokens          []string        `yaml:"invite_tokens"`
+	RequireLogin          bool            `yaml:"require_login"`
+	AuditVoters           bool            `yaml:"audit_voters"`
+	Countdown             int64           `yaml:"countdown"`
+	DashboardDisplayLimit int             `yaml:"dashboard_display_limit"`
+	Candidates            []string        `yaml:"candidates"`
+	Webhooks              []webhookConfig `yaml:"webhooks"`
+}
+
+type webhookConfig struct {
+	URL    string          `yaml:"url"`
+	Secret string          `yaml:"secret"`
+	Events []webhook.Event `yaml:"events"`
+}
+
+func loadRoomConfig(path string) (*roomConfig, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config roomConfig
+	if err := yaml.Unmarshal(buf, &config); err != nil {
+		return nil, err
+	}
+
+	if len(config.Candidates) == 0 {
+		return nil, errors.New(path + ": no candidates")
+	}
+
+	return &config, nil
+}
+
+// request returns the REST API request creating the room.
+func (c *roomConfig) request() room.CreateRoomAPIRequest {
+	candidates := make([]*room.Candidate, 0, len(c.Candidates))
+	for _, name := range c.Candidates {
+		candidates = append(candidates, &room.Candidate{Name: name})
+	}
+
+	webhooks := make([]webhook.Endpoint, 0, len(c.Webhooks))
+	for _, w := range c.Webhooks {
+		webhooks = append(webhooks, webhook.Endpoint{URL: w.URL, Secret: w.Secret, Events: w.Events})
+	}
+
+	return room.CreateRoomAPIRequest{
+		CreateRoomRequest: room.CreateRoomRequest{
+			UID:          c.UID,
+			RoomTitle:    c.Title,
+			Passcode:     c.Passcode,
+			InviteTokens: c.InviteTokens,
+			RequireLogin: c.RequireLogin,
+			AuditVoters:  c.AuditVoters,
+			Webhooks:     webhooks,
+		},
+		GameSettings: room.GameSettings{
+			Candidates:            candidates,
+			Countdown:             c.Countdown,
+			DashboardDisplayLimit: c.DashboardDisplayLimit,
+		},
+	}
+}
@@ -0,0 +1,238 @@
+// Command votectl hosts a room from the terminal. It creates rooms from a YAML
+// file, prints the join URL as a QR code, starts and ends rounds, and streams
+// the live dashboard as a table.
+//
+//	votectl create -f room.yaml [-watch]
+//	votectl qr     -room <room id>
+//	votectl start  -room <room id> -token <host token>
+//	votectl stop   -room <room id> -token <host token>
+//	votectl end    -room <room id> -token <host token>
+//	votectl watch  -room <room id> [-token <host token>]
+//
+// The server defaults to $VOTE_SERVER and the host token to $VOTE_TOKEN.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"main/client"
+	"main/internal/controller/room"
+)
+
+const _usage = `usage: votectl <command> [flags]
+
+commands:
+  create  create a room from a YAML file and print its join QR code
+  qr      print the join URL and QR code of a room
+  start   start the next round
+  stop    stop the running round
+  end     end the game
+  watch   stream the live dashboard
+
+run 'votectl <command> -h' for the flags of a command.
+`
+
+// options are the flags shared by the commands.
+type options struct {
+	server    string
+	publicURL string
+	roomID    string
+	token     string
+	invert    bool
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.server, "server", envOr("VOTE_SERVER", "http://localhost:8080"), "base URL of the server")
+	fs.StringVar(&o.publicURL, "public-url", "", "base URL players open, the server URL when empty")
+	fs.StringVar(&o.roomID, "room", "", "room ID")
+	fs.StringVar(&o.token, "token", os.Getenv("VOTE_TOKEN"), "host token of the room")
+	fs.BoolVar(&o.invert, "invert", false, "print the QR code for terminals with a light background")
+}
+
+// joinURL returns the URL players open to join the room.
+func (o *options) joinURL(roomID string) string {
+	base := o.publicURL
+	if len(base) == 0 {
+		base = o.server
+	}
+
+	return strings.TrimSuffix(base, "/") + "/vote/" + roomID
+}
+
+func (o *options) host(c *client.Client) (*client.Host, error) {
+	if len(o.roomID) == 0 {
+		return nil, errors.New("-room is required")
+	}
+
+	if len(o.token) == 0 {
+		return nil, errors.New("-token is required")
+	}
+
+	return c.Host(o.roomID, o.token), nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, _usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"create": create,
+		"qr":     qr,
+		"start":  roundCommand("start", (*client.Host).StartRound),
+		"stop":   roundCommand("stop", (*client.Host).StopRound),
+		"end":    roundCommand("end", (*client.Host).EndGame),
+		"watch":  watch,
+	}
+
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprint(os.Stderr, _usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := command(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "votectl:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// parse parses the flags of command, exiting on errors like the flag package does.
+func parse(command string, args []string, o *options, register func(fs *flag.FlagSet)) *client.Client {
+	fs := flag.NewFlagSet("votectl "+command, flag.ExitOnError)
+	o.register(fs)
+	if register != nil {
+		register(fs)
+	}
+
+	fs.Parse(args)
+
+	c, err := client.New(o.server)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "votectl:", err)
+		os.Exit(2)
+	}
+
+	return c
+}
+
+func create(ctx context.Context, args []string) error {
+	var (
+		o    options
+		file string
+		live bool
+	)
+
+	c := parse("create", args, &o, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "f", "room.yaml", "YAML file of the room")
+		fs.BoolVar(&live, "watch", false, "stream the live dashboard once the room is created")
+	})
+
+	config, err := loadRoomConfig(file)
+	if err != nil {
+		return err
+	}
+
+	host, err := c.CreateRoom(ctx, config.request())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("room:       %s\n", host.RoomID)
+	fmt.Printf("host token: %s\n", host.Token)
+	if len(host.Passcode) != 0 {
+		fmt.Printf("passcode:   %s\n", host.Passcode)
+	}
+
+	if err := printQRCode(os.Stdout, o.joinURL(host.RoomID), o.invert); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nexport VOTE_TOKEN=%s\n", host.Token)
+
+	if !live {
+		return nil
+	}
+
+	return watchRoom(ctx, host, config.Title)
+}
+
+func qr(_ context.Context, args []string) error {
+	var o options
+	parse("qr", args, &o, nil)
+
+	if len(o.roomID) == 0 {
+		return errors.New("-room is required")
+	}
+
+	return printQRCode(os.Stdout, o.joinURL(o.roomID), o.invert)
+}
+
+// roundCommand returns the command calling the round method of the host.
+func roundCommand(name string, call func(h *client.Host, ctx context.Context) (*room.RoundResponse, error)) func(ctx context.Context, args []string) error {
+	return func(ctx context.Context, args []string) error {
+		var o options
+		c := parse(name, args, &o, nil)
+
+		host, err := o.host(c)
+		if err != nil {
+			return err
+		}
+
+		round, err := call(host, ctx)
+		if err != nil {
+			return err
+		}
+
+		if round.GameOver {
+			fmt.Printf("game over after round %d\n", round.Round)
+			return nil
+		}
+
+		fmt.Printf("round %d, ends at %s\n", round.Round, time.UnixMilli(round.EndTime).Format(time.TimeOnly))
+
+		return nil
+	}
+}
+
+func watch(ctx context.Context, args []string) error {
+	var o options
+	c := parse("watch", args, &o, nil)
+
+	if len(o.roomID) == 0 {
+		return errors.New("-room is required")
+	}
+
+	host := c.Host(o.roomID, o.token)
+
+	title := ""
+	if len(o.token) != 0 {
+		// HINT: the title is only known to the REST API, which needs the host token.
+		if info, err := host.Room(ctx); err == nil {
+			title = info.Title
+		}
+	}
+
+	return watchRoom(ctx, host, title)
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return fallback
+}
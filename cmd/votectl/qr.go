@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/yeqown/go-qrcode"
+)
+
+// printQRCode prints url and its QR code, two modules a line with half blocks.
+// The light modules are drawn, which scans on terminals with a dark background,
+// invert draws the dark modules instead.
+func printQRCode(w io.Writer, url string, invert bool) error {
+	fmt.Fprintf(w, "join URL:   %s\n\n", url)
+
+	qrc, err := qrcode.New(url,
+		qrcode.WithQRWidth(1),
+		qrcode.WithBorderWidth(2),
+		qrcode.WithCustomImageEncoder(terminalEncoder{invert: invert}),
+	)
+	if err != nil {
+		return err
+	}
+
+	return qrc.SaveTo(w)
+}
+
+// terminalEncoder encodes a QR code image drawn with one pixel a module as text.
+type terminalEncoder struct {
+	invert bool
+}
+
+func (e terminalEncoder) Encode(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	drawn := func(x, y int) bool {
+		if y >= bounds.Max.Y {
+			// HINT: the half line below an odd height image is quiet zone.
+			return !e.invert
+		}
+
+		gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+
+		return (gray.Y >= 128) != e.invert
+	}
+
+	var b strings.Builder
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += 2 {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			switch top, bottom := drawn(x, y), drawn(x, y+1); {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
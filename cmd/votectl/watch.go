@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"main/client"
+	"main/internal/controller/room"
+)
+
+const (
+	_barWidth       = 30
+	_reconnectDelay = 2 * time.Second
+)
+
+// watchRoom streams the dashboard of the room until the game is over, the
+// room is gone or ctx is done. Dropped connections are reconnected.
+func watchRoom(ctx context.Context, host *client.Host, title string) error {
+	tty := isTerminal(os.Stdout)
+	for {
+		over, err := watchConn(ctx, host, title, tty)
+		if over || ctx.Err() != nil {
+			return nil
+		}
+
+		var httpErr *client.HTTPError
+		if errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusNotFound || httpErr.StatusCode == http.StatusGone) {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "connection lost (%v), reconnecting\n", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(_reconnectDelay):
+		}
+	}
+}
+
+// watchConn renders the dashboard on every message of a host connection, and
+// every second for the countdown. It reports whether the game is over.
+func watchConn(ctx context.Context, host *client.Host, title string, tty bool) (bool, error) {
+	hc, err := host.Connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer hc.Close()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	render(os.Stdout, host.RoomID, title, hc, tty)
+	for {
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-ticker.C:
+			if !tty {
+				continue
+			}
+		case msg, ok := <-hc.Events():
+			if !ok {
+				return false, hc.Err()
+			}
+
+			if msg.Restart != nil {
+				fmt.Fprintln(os.Stderr, "server restarting:", msg.Restart.Message)
+			}
+
+			if !changed(msg) {
+				continue
+			}
+		}
+
+		render(os.Stdout, host.RoomID, title, hc, tty)
+		if hc.GameOver() {
+			return true, nil
+		}
+	}
+}
+
+// changed reports whether msg changes what is rendered.
+func changed(msg room.HostWsMessageOutgoing) bool {
+	return msg.Connect != nil || msg.Round != nil || msg.Dashboard != nil || msg.DashboardDelta != nil || msg.Player != nil
+}
+
+// render prints the state of the room and the dashboard as a table. Terminals
+// are cleared first so the table updates in place.
+func render(w io.Writer, roomID, title string, hc *client.HostConn, tty bool) {
+	if tty {
+		fmt.Fprint(w, "\033[H\033[2J")
+	}
+
+	if len(title) != 0 {
+		fmt.Fprintf(w, "%s (room %s)\n", title, roomID)
+	} else {
+		fmt.Fprintf(w, "room %s\n", roomID)
+	}
+
+	fmt.Fprintln(w, status(hc))
+	fmt.Fprintln(w)
+
+	dashboard, _ := hc.Dashboard()
+	top := 0
+	for _, c := range dashboard {
+		top = max(top, c.Score)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tCANDIDATE\tVOTES\t")
+	for i, c := range dashboard {
+		bar := 0
+		if top != 0 {
+			bar = c.Score * _barWidth / top
+		}
+
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\n", i+1, c.Name, c.Score, strings.Repeat("█", bar))
+	}
+	tw.Flush()
+
+	if !tty {
+		fmt.Fprintln(w)
+	}
+}
+
+func status(hc *client.HostConn) string {
+	players := fmt.Sprintf("players online: %d", len(hc.Players()))
+	switch round := hc.Round(); {
+	case hc.GameOver():
+		return fmt.Sprintf("game over after round %d · %s", round, players)
+	case round == 0:
+		return "waiting for the first round · " + players
+	default:
+		left := time.Until(time.UnixMilli(hc.EndTime())).Round(time.Second)
+		if left <= 0 {
+			return fmt.Sprintf("round %d is over · %s", round, players)
+		}
+
+		return fmt.Sprintf("round %d · %s left · %s", round, left, players)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// distribution is a random delay, set from a flag such as:
+//
+//	fixed:1s         always 1s
+//	uniform:0s,5s    between 0s and 5s
+//	exp:2s           exponential with a mean of 2s
+//	normal:3s,500ms  normal with a mean of 3s and a deviation of 500ms, at least 0
+type distribution struct {
+	spec   string
+	sample func(r *rand.Rand) time.Duration
+}
+
+func (d *distribution) String() string {
+	return d.spec
+}
+
+func (d *distribution) Set(spec string) error {
+	kind, args, _ := strings.Cut(spec, ":")
+	values := []time.Duration{}
+	for _, arg := range strings.Split(args, ",") {
+		value, err := time.ParseDuration(strings.TrimSpace(arg))
+		if err != nil {
+			return fmt.Errorf("distribution %q: %w", spec, err)
+		}
+
+		values = append(values, value)
+	}
+
+	want := map[string]int{"fixed": 1, "uniform": 2, "exp": 1, "normal": 2}
+	n, ok := want[kind]
+	if !ok {
+		return fmt.Errorf("distribution %q: unknown kind %q", spec, kind)
+	}
+
+	if len(values) != n {
+		return fmt.Errorf("distribution %q: %s takes %d durations", spec, kind, n)
+	}
+
+	switch kind {
+	case "fixed":
+		d.sample = func(*rand.Rand) time.Duration { return values[0] }
+	case "uniform":
+		low, high := values[0], values[1]
+		if high < low {
+			return fmt.Errorf("distribution %q: %s is before %s", spec, high, low)
+		}
+
+		d.sample = func(r *rand.Rand) time.Duration { return low + time.Duration(r.Int63n(int64(high-low)+1)) }
+	case "exp":
+		mean := values[0]
+		d.sample = func(r *rand.Rand) time.Duration { return time.Duration(r.ExpFloat64() * float64(mean)) }
+	case "normal":
+		mean, deviation := values[0], values[1]
+		d.sample = func(r *rand.Rand) time.Duration {
+			return time.Duration(math.Max(0, r.NormFloat64()*float64(deviation)+float64(mean)))
+		}
+	}
+
+	d.spec = spec
+
+	return nil
+}
+
+// mustDistribution returns the distribution of spec, for the flag defaults.
+func mustDistribution(spec string) *distribution {
+	d := &distribution{}
+	if err := d.Set(spec); err != nil {
+		panic(err)
+	}
+
+	return d
+}
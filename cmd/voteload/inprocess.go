@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+
+	"main/internal/controller/room"
+	"main/internal/logger"
+	"main/internal/server"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// startInProcess starts the server in this process, logging only errors and
+// without rate limits, so a room takes as many players as the machine holds.
+// The load only goes through the API, so the pages are never parsed and the
+// vendored assets are not needed.
+func startInProcess(ctx context.Context) (*httptest.Server, error) {
+	viper.Set("log.level", "error")
+	viper.Set("log.output", "stderr")
+	for _, policy := range []string{"create_room", "join", "upgrade", "message"} {
+		viper.Set("rate_limit."+policy+".ip.rate", 0)
+		viper.Set("rate_limit."+policy+".player.rate", 0)
+		viper.Set("rate_limit."+policy+".room.rate", 0)
+	}
+
+	if err := logger.Init(); err != nil {
+		return nil, err
+	}
+
+	prometheus.MustRegister(room.NewCollector())
+
+	mux := http.NewServeMux()
+	server.Register(mux)
+	go room.RunJanitor(ctx)
+
+	return httptest.NewServer(server.Handler(mux)), nil
+}
@@ -0,0 +1,417 @@
+// Command voteload load tests a vote server with simulated players. The players
+// join the room, connect the player websocket and vote in every round with the
+// configured timing, while a host drives the rounds. It reports the join and
+// vote ack latencies, the messages the players missed and the goroutines of
+// the server.
+//
+//	voteload -players 500 -rounds 3                       # in-process server
+//	voteload -server http://localhost:8080 -players 200   # running server
+//
+// A running server rate limits the joins and upgrades of a room, raise
+// rate_limit.join.room and rate_limit.upgrade.room in its config for rooms
+// larger than their burst. The in-process server has no rate limits. Every
+// player holds a connection, raise ulimit -n for large runs.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"main/client"
+	"main/internal/controller/room"
+)
+
+const (
+	_gameOverTimeout = 10 * time.Second
+	_sampleInterval  = 500 * time.Millisecond
+	_settleTime      = 2 * time.Second
+)
+
+type options struct {
+	server       string
+	metricsToken string
+	players      int
+	rounds       int
+	candidates   int
+	countdown    time.Duration
+	join         *distribution
+	vote         *distribution
+	seed         int64
+}
+
+func main() {
+	o := options{
+		join: mustDistribution("uniform:0s,2s"),
+		vote: mustDistribution("uniform:0s,5s"),
+	}
+
+	flag.StringVar(&o.server, "server", "", "base URL of the server, an in-process server is started when empty")
+	flag.StringVar(&o.metricsToken, "metrics-token", "", "metrics.secret of the server, to scrape /metrics")
+	flag.IntVar(&o.players, "players", 100, "simulated players")
+	flag.IntVar(&o.rounds, "rounds", 3, "rounds played")
+	flag.IntVar(&o.candidates, "candidates", 4, "candidates of the room")
+	flag.DurationVar(&o.countdown, "countdown", 10*time.Second, "length of a round, in whole seconds")
+	flag.Var(o.join, "join", "delay of the joins from the start: fixed:D, uniform:D,D, exp:MEAN or normal:MEAN,DEVIATION")
+	flag.Var(o.vote, "vote", "delay of the votes from the start of a round, like -join")
+	flag.Int64Var(&o.seed, "seed", time.Now().UnixNano(), "seed of the random delays and choices")
+	flag.Parse()
+
+	if o.players <= 0 || o.rounds <= 0 || o.candidates <= 0 || o.countdown < time.Second {
+		fmt.Fprintln(os.Stderr, "voteload: -players, -rounds and -candidates must be positive, -countdown at least 1s")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	inProcess := len(o.server) == 0
+	if inProcess {
+		srv, err := startInProcess(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "voteload:", err)
+			os.Exit(1)
+		}
+		defer srv.Close()
+
+		o.server = srv.URL
+	}
+
+	if err := run(ctx, o, inProcess); err != nil {
+		fmt.Fprintln(os.Stderr, "voteload:", err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// result is what the simulated players measured.
+type result struct {
+	join           *latencies
+	vote           *latencies
+	missedRounds   atomic.Int64
+	missedGameOver atomic.Int64
+	gaps           atomic.Int64
+	dropped        atomic.Int64
+}
+
+func run(ctx context.Context, o options, inProcess bool) error {
+	c, err := client.New(o.server)
+	if err != nil {
+		return err
+	}
+
+	s := &sampler{
+		inProcess: inProcess,
+		metrics:   strings.TrimSuffix(o.server, "/") + "/metrics",
+		token:     o.metricsToken,
+		http:      &http.Client{Timeout: 5 * time.Second},
+	}
+
+	candidates := make([]*room.Candidate, 0, o.candidates)
+	for i := 0; i < o.candidates; i++ {
+		candidates = append(candidates, &room.Candidate{Name: fmt.Sprintf("candidate %d", i+1)})
+	}
+
+	before := s.sample(ctx, "")
+	host, err := c.CreateRoom(ctx, room.CreateRoomAPIRequest{
+		CreateRoomRequest: room.CreateRoomRequest{RoomTitle: "voteload"},
+		GameSettings:      room.GameSettings{Candidates: candidates, Countdown: int64(o.countdown / time.Second)},
+	})
+	if err != nil {
+		return fmt.Errorf("create room: %w", err)
+	}
+
+	hc, err := host.Connect(ctx)
+	if err != nil {
+		return fmt.Errorf("connect host: %w", err)
+	}
+	defer hc.Close()
+
+	go func() {
+		for range hc.Events() {
+		}
+	}()
+
+	fmt.Printf("voteload: room %s on %s, %d players, %d rounds of %s\n", host.RoomID, o.server, o.players, o.rounds, o.countdown)
+
+	res := &result{join: newLatencies(), vote: newLatencies()}
+	ended, release := make(chan struct{}), make(chan struct{})
+	var joined, finished, closed sync.WaitGroup
+	joined.Add(o.players)
+	finished.Add(o.players)
+	closed.Add(o.players)
+
+	start := time.Now()
+	for i := 0; i < o.players; i++ {
+		p := &simulatedPlayer{
+			c:        c,
+			roomID:   host.RoomID,
+			index:    i,
+			o:        o,
+			res:      res,
+			rng:      rand.New(rand.NewSource(o.seed + int64(i))),
+			joined:   joined.Done,
+			finished: finished.Done,
+			ended:    ended,
+			release:  release,
+		}
+
+		go func() {
+			defer closed.Done()
+			p.run(ctx, start)
+		}()
+	}
+
+	joined.Wait()
+	fmt.Printf("joined in %s\n", time.Since(start).Round(time.Millisecond))
+
+	peak := s.sample(ctx, host.RoomID)
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+
+		ticker := time.NewTicker(_sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-sampleCtx.Done():
+				return
+			case <-ticker.C:
+				now := s.sample(sampleCtx, host.RoomID)
+				peak.goroutines = max(peak.goroutines, now.goroutines)
+				peak.playerQueue = max(peak.playerQueue, now.playerQueue)
+				peak.playersOnline = max(peak.playersOnline, now.playersOnline)
+			}
+		}
+	}()
+
+	for round := 1; round <= o.rounds; round++ {
+		if err := hc.StartRound(ctx); err != nil {
+			stopSampling()
+			return fmt.Errorf("start round %d: %w", round, err)
+		}
+
+		fmt.Printf("round %d started\n", round)
+		if !sleep(ctx, o.countdown) {
+			break
+		}
+	}
+
+	if err := hc.EndGame(ctx); err != nil && ctx.Err() == nil {
+		stopSampling()
+		return fmt.Errorf("end game: %w", err)
+	}
+
+	close(ended)
+	finished.Wait()
+	stopSampling()
+	<-sampled
+
+	close(release)
+	closed.Wait()
+	hc.Close()
+	sleep(ctx, _settleTime)
+	after := s.sample(context.Background(), host.RoomID)
+
+	fmt.Println()
+	fmt.Printf("join        %s\n", res.join.summary())
+	fmt.Printf("vote ack    %s\n", res.vote.summary())
+	fmt.Printf("dropped     round messages %d, game over messages %d, dashboard gaps %d, client events %d\n",
+		res.missedRounds.Load(), res.missedGameOver.Load(), res.gaps.Load(), res.dropped.Load())
+	fmt.Printf("goroutines  before %s, peak %s, after %s\n", count(before.goroutines), count(peak.goroutines), count(after.goroutines))
+	fmt.Printf("server      players online max %d, player queue depth max %d\n", peak.playersOnline, peak.playerQueue)
+
+	return nil
+}
+
+// simulatedPlayer joins the room, votes in every round and reports what it saw.
+type simulatedPlayer struct {
+	c        *client.Client
+	roomID   string
+	index    int
+	o        options
+	res      *result
+	rng      *rand.Rand
+	joined   func()
+	finished func()
+	ended    <-chan struct{}
+	release  <-chan struct{}
+	votes    sync.WaitGroup
+}
+
+func (sp *simulatedPlayer) run(ctx context.Context, start time.Time) {
+	joined, finished := sp.joined, sp.finished
+	defer func() {
+		// HINT: a player which failed to join counts as joined and finished.
+		if joined != nil {
+			joined()
+		}
+
+		if finished != nil {
+			finished()
+		}
+	}()
+
+	if !sleep(ctx, time.Until(start.Add(sp.o.join.sample(sp.rng)))) {
+		return
+	}
+
+	begin := time.Now()
+	p, err := sp.c.JoinRoom(ctx, sp.roomID, fmt.Sprintf("load-%d", sp.index), fmt.Sprintf("player %d", sp.index), client.JoinOptions{})
+	if err != nil {
+		sp.res.join.fail(reason(err))
+		return
+	}
+	defer p.Close()
+
+	sp.res.join.observe(time.Since(begin))
+	joined()
+	joined = nil
+
+	seen := map[int]bool{}
+	_, seq := p.Dashboard()
+	ended := sp.ended
+
+	// HINT: once the host ended the game, the game over message gets a timeout.
+	var timeout <-chan time.Time
+
+loop:
+	for !p.GameOver() {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ended:
+			ended = nil
+			timeout = time.After(_gameOverTimeout)
+		case <-timeout:
+			break loop
+		case msg, ok := <-p.Events():
+			if !ok {
+				break loop
+			}
+
+			seq = sp.checkSeq(msg, seq)
+			if msg.Round != nil && msg.Round.Round != 0 && !msg.Round.GameOver && !seen[msg.Round.Round] {
+				seen[msg.Round.Round] = true
+				sp.vote(ctx, p, msg.Round.Round)
+			}
+		}
+	}
+
+	// HINT: the votes still waiting for their delay are sent before leaving.
+	sp.votes.Wait()
+
+	sp.res.missedRounds.Add(int64(max(sp.o.rounds-len(seen), 0)))
+	if !p.GameOver() {
+		sp.res.missedGameOver.Add(1)
+	}
+
+	sp.res.dropped.Add(p.Dropped())
+	finished()
+	finished = nil
+
+	select {
+	case <-ctx.Done():
+	case <-sp.release:
+	}
+}
+
+// checkSeq counts the dashboard deltas skipped before msg, and returns the
+// sequence number seen so far.
+func (sp *simulatedPlayer) checkSeq(msg room.PlayerWsMessageOutgoing, seq int64) int64 {
+	switch {
+	case msg.DashboardDelta != nil:
+		if msg.DashboardDelta.Seq > seq+1 {
+			sp.res.gaps.Add(1)
+		}
+
+		return max(seq, msg.DashboardDelta.Seq)
+	case msg.Dashboard != nil:
+		return max(seq, msg.Dashboard.Seq)
+	case msg.Round != nil:
+		return max(seq, msg.Round.Seq)
+	case msg.Connect != nil:
+		return max(seq, msg.Connect.Seq)
+	default:
+		return seq
+	}
+}
+
+// vote votes for a random candidate of round after the vote delay.
+func (sp *simulatedPlayer) vote(ctx context.Context, p *client.Player, round int) {
+	delay := sp.o.vote.sample(sp.rng)
+	candidates := p.Candidates()
+	if len(candidates) == 0 {
+		sp.res.vote.fail("no candidates")
+		return
+	}
+
+	candidate := candidates[sp.rng.Intn(len(candidates))].ID
+	sp.votes.Add(1)
+	go func() {
+		defer sp.votes.Done()
+
+		if !sleep(ctx, delay) {
+			return
+		}
+
+		begin := time.Now()
+		if _, err := p.VoteRound(ctx, round, candidate); err != nil {
+			sp.res.vote.fail(reason(err))
+			return
+		}
+
+		sp.res.vote.observe(time.Since(begin))
+	}()
+}
+
+// reason returns the reason of err to group the failures by.
+func reason(err error) string {
+	var roomErr *room.Error
+	if errors.As(err, &roomErr) {
+		return string(roomErr.Code)
+	}
+
+	var httpErr *client.HTTPError
+	if errors.As(err, &httpErr) {
+		return fmt.Sprintf("status %d", httpErr.StatusCode)
+	}
+
+	return err.Error()
+}
+
+// sleep waits for d, it returns false when ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func count(n int) string {
+	if n < 0 {
+		return "?"
+	}
+
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencies collects the durations of an operation and its errors by reason.
+type latencies struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	errors    map[string]int
+}
+
+func newLatencies() *latencies {
+	return &latencies{errors: map[string]int{}}
+}
+
+func (l *latencies) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.durations = append(l.durations, d)
+}
+
+func (l *latencies) fail(reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.errors[reason]++
+}
+
+// summary returns the count and percentiles of the durations, and the errors.
+func (l *latencies) summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b strings.Builder
+	sorted := append([]time.Duration(nil), l.durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	fmt.Fprintf(&b, "ok %d", len(sorted))
+	if len(sorted) != 0 {
+		fmt.Fprintf(&b, ", p50 %s, p90 %s, p99 %s, max %s",
+			percentile(sorted, 0.5), percentile(sorted, 0.9), percentile(sorted, 0.99), percentile(sorted, 1))
+	}
+
+	reasons := make([]string, 0, len(l.errors))
+	for reason := range l.errors {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "\n    failed %d: %s", l.errors[reason], reason)
+	}
+
+	return b.String()
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(float64(len(sorted))*p+0.5) - 1
+
+	return sorted[min(max(i, 0), len(sorted)-1)].Round(10 * time.Microsecond)
+}
+
+// sample is what the server reports at one point of the run. Goroutines is -1
+// when it is unknown.
+type sample struct {
+	goroutines    int
+	playerQueue   int
+	playersOnline int
+}
+
+// sampler reads the goroutines and queues of the server. In-process servers
+// are read directly, the others are scraped from /metrics.
+type sampler struct {
+	inProcess bool
+	metrics   string
+	token     string
+	http      *http.Client
+}
+
+func (s *sampler) sample(ctx context.Context, roomID string) sample {
+	result := sample{goroutines: -1}
+	if s.inProcess {
+		result.goroutines = serverGoroutines()
+	}
+
+	values, err := s.scrape(ctx)
+	if err != nil {
+		return result
+	}
+
+	if !s.inProcess {
+		if v, ok := values["go_goroutines"]; ok {
+			result.goroutines = int(v)
+		}
+	}
+
+	room := `{room_id="` + roomID + `"}`
+	result.playerQueue = int(values["vote_room_player_queue_depth_max"+room])
+	result.playersOnline = int(values["vote_room_players_connected"+room])
+
+	return result
+}
+
+// scrape returns the values of the metrics by name and labels, as written in
+// the text exposition format.
+func (s *sampler) scrape(ctx context.Context) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.metrics, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.token) != 0 {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics: %s", resp.Status)
+	}
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+
+		if v, err := strconv.ParseFloat(line[i+1:], 64); err == nil {
+			values[line[:i]] = v
+		}
+	}
+
+	return values, scanner.Err()
+}
+
+// serverGoroutines counts the goroutines of the in-process server, leaving out
+// the simulated players sharing the process.
+func serverGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+
+	count := 0
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(stack, []byte("main/client.")) {
+			continue
+		}
+
+		if bytes.Contains(stack, []byte("main/internal/")) || bytes.Contains(stack, []byte("net/http.(*conn).serve")) {
+			count++
+		}
+	}
+
+	return count
+}
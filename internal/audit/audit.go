@@ -0,0 +1,346 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"main/internal/utils"
+
+	"github.com/spf13/viper"
+)
+
+// Kind is the kind of an audit entry.
+type Kind string
+
+const (
+	// KindVote is a vote submitted to VoteCandidate, accepted or rejected.
+	KindVote Kind = "vote"
+	// KindTally is the dashboard of a room at the time it was recorded.
+	KindTally Kind = "tally"
+	// KindIdentity binds a voter pseudonym to the subject verified by the
+	// identity provider, recorded only for rooms auditing voters.
+	KindIdentity Kind = "identity"
+)
+
+// GenesisHash is the previous hash of the first entry.
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+const _pseudonymLength = 16
+
+// Entry is a line of the audit log. Hash covers every other field, including
+// the hash of the previous entry, so altering, dropping or reordering entries
+// breaks the chain. The hash is an HMAC keyed with audit.secret, without the
+// secret anyone rewriting the whole file can rewrite the chain as well, and
+// only partial edits are caught. Instance tells apart the games played under
+// one room ID.
+type Entry struct {
+	Seq       int64          `json:"seq"`
+	Time      int64          `json:"time"`
+	Kind      Kind           `json:"kind"`
+	RoomID    string         `json:"room_id"`
+	Instance  string         `json:"instance,omitempty"`
+	Round     int            `json:"round,omitempty"`
+	Voter     string         `json:"voter,omitempty"`
+	Subject   string         `json:"subject,omitempty"`
+	Candidate string         `json:"candidate,omitempty"`
+	Accepted  bool           `json:"accepted,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+	Tally     map[string]int `json:"tally,omitempty"`
+	PrevHash  string         `json:"prev_hash"`
+	Hash      string         `json:"hash"`
+}
+
+// computeHash returns the HMAC of the entry keyed with key, or its SHA-256
+// when key is empty.
+func (e Entry) computeHash(key []byte) (string, error) {
+	e.Hash = ""
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	if len(key) == 0 {
+		sum := sha256.Sum256(buf)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(buf)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// room returns the key of the game the entry belongs to.
+func (e Entry) room() string {
+	if len(e.Instance) == 0 {
+		return e.RoomID
+	}
+
+	return e.RoomID + "#" + e.Instance
+}
+
+// Log is an append-only, hash-chained audit log file. A nil Log drops every entry.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	key      []byte
+	seq      int64
+	lastHash string
+}
+
+var _default = utils.NewSyncValue[*Log](nil)
+
+// Init opens the audit log at audit.path as the default log, chained with
+// audit.secret. An empty path disables the audit log.
+func Init() error {
+	path := viper.GetString("audit.path")
+	if len(path) == 0 {
+		return nil
+	}
+
+	secret := viper.GetString("audit.secret")
+	if len(secret) == 0 {
+		slog.Warn("audit.secret is not set, the audit log only detects partial edits")
+	}
+
+	l, err := Open(path, []byte(secret))
+	if err != nil {
+		return err
+	}
+
+	_default.Store(l)
+	slog.Info("audit log opened", "path", path, "seq", l.seq)
+
+	return nil
+}
+
+// Default returns the log opened by Init, nil when the audit log is disabled.
+func Default() *Log {
+	return _default.Load()
+}
+
+// Open opens the audit log at path, continuing the chain of the existing
+// entries. The hashes are keyed with key, an empty key leaves them unkeyed.
+func Open(path string, key []byte) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{file: file, key: key, lastHash: GenesisHash}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			file.Close()
+			return nil, errors.New("audit log is corrupted, verify it before appending")
+		}
+
+		l.seq, l.lastHash = e.Seq, e.Hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Append chains the entry to the log and writes it.
+func (l *Log) Append(e Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.Time = time.Now().UnixMilli()
+	e.PrevHash = l.lastHash
+
+	hash, err := e.computeHash(l.key)
+	if err != nil {
+		return err
+	}
+
+	e.Hash = hash
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(buf, '\n')); err != nil {
+		return err
+	}
+
+	l.seq, l.lastHash = e.Seq, e.Hash
+
+	return nil
+}
+
+// Close flushes the log to disk and closes it.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+
+	return l.file.Close()
+}
+
+var _pseudonymKey = sync.OnceValue(func() []byte {
+	if secret := viper.GetString("audit.secret"); len(secret) != 0 {
+		return []byte(secret)
+	}
+
+	slog.Warn("audit.secret is not set, voter pseudonyms change after a restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	return key
+})
+
+// Pseudonym returns the stable pseudonym of a voter in a room. It links the
+// votes of a voter without revealing who the voter is.
+func Pseudonym(roomID, uid string) string {
+	mac := hmac.New(sha256.New, _pseudonymKey())
+	mac.Write([]byte(roomID + "|" + uid))
+
+	return hex.EncodeToString(mac.Sum(nil))[:_pseudonymLength]
+}
+
+// Report is the result of replaying an audit log.
+type Report struct {
+	Entries    int
+	Votes      int
+	Rejected   int
+	Identities int
+	// Tally is the dashboard recomputed from the accepted votes, by game and
+	// candidate. A game is keyed by its room ID and instance, "room#instance".
+	Tally    map[string]map[string]int
+	Problems []string
+}
+
+// OK reports whether the log has no problems.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify replays the log from r. It checks the hash chain keyed with key, then
+// recomputes the dashboard of every game from the accepted votes and compares
+// it with the recorded tallies.
+func Verify(r io.Reader, key []byte) (*Report, error) {
+	report := &Report{Tally: map[string]map[string]int{}}
+	voted := map[string]bool{}
+	prevHash, prevSeq := GenesisHash, int64(0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			report.problem(line, "malformed entry: "+err.Error())
+			continue
+		}
+
+		report.Entries++
+		if e.Seq != prevSeq+1 {
+			report.problem(line, fmt.Sprintf("sequence jumps from %d to %d", prevSeq, e.Seq))
+		}
+
+		if e.PrevHash != prevHash {
+			report.problem(line, "previous hash does not match the entry before it")
+		}
+
+		if hash, err := e.computeHash(key); err != nil || hash != e.Hash {
+			report.problem(line, "hash does not match the entry content")
+		}
+
+		prevHash, prevSeq = e.Hash, e.Seq
+
+		tally, ok := report.Tally[e.room()]
+		if !ok {
+			tally = map[string]int{}
+			report.Tally[e.room()] = tally
+		}
+
+		switch e.Kind {
+		case KindVote:
+			if !e.Accepted {
+				report.Rejected++
+				continue
+			}
+
+			key := fmt.Sprintf("%s|%d|%s", e.room(), e.Round, e.Voter)
+			if voted[key] {
+				report.problem(line, fmt.Sprintf("voter %s has more than one accepted vote in round %d", e.Voter, e.Round))
+			}
+
+			voted[key] = true
+			report.Votes++
+			tally[e.Candidate]++
+		case KindIdentity:
+			if len(e.Voter) == 0 || len(e.Subject) == 0 {
+				report.problem(line, "identity without a voter or subject")
+				continue
+			}
+
+			report.Identities++
+		case KindTally:
+			for _, mismatch := range compareTally(tally, e.Tally) {
+				report.problem(line, fmt.Sprintf("room %s %s", e.room(), mismatch))
+			}
+		default:
+			report.problem(line, "unknown kind "+string(e.Kind))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func compareTally(replayed, recorded map[string]int) []string {
+	var mismatches []string
+	for candidate, score := range recorded {
+		if replayed[candidate] != score {
+			mismatches = append(mismatches, fmt.Sprintf("candidate %s recorded %d, replayed %d", candidate, score, replayed[candidate]))
+		}
+	}
+
+	for candidate, score := range replayed {
+		if _, ok := recorded[candidate]; !ok && score != 0 {
+			mismatches = append(mismatches, fmt.Sprintf("candidate %s missing from the tally, replayed %d", candidate, score))
+		}
+	}
+
+	return mismatches
+}
+
+func (r *Report) problem(line int, msg string) {
+	r.Problems = append(r.Problems, fmt.Sprintf("line %d: %s", line, msg))
+}
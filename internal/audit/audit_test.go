@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var _testKey = []byte("audit-secret")
+
+// writeLog appends entries to a new log keyed with key and returns its content.
+func writeLog(t *testing.T, key []byte, entries ...Entry) []byte {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+		if err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func vote(instance, voter, candidate string) Entry {
+	return Entry{Kind: KindVote, RoomID: "room", Instance: instance, Round: 1, Voter: voter, Candidate: candidate, Accepted: true}
+}
+
+func tally(instance string, scores map[string]int) Entry {
+	return Entry{Kind: KindTally, RoomID: "room", Instance: instance, Round: 1, Tally: scores}
+}
+
+func TestVerifyReusedRoomID(t *testing.T) {
+	buf := writeLog(t, _testKey,
+		vote("first", "alice", "a"),
+		vote("first", "bob", "b"),
+		tally("first", map[string]int{"a": 1, "b": 1}),
+		// HINT: a second game under the same room ID starts from a zero tally.
+		vote("second", "alice", "a"),
+		tally("second", map[string]int{"a": 1, "b": 0}),
+	)
+
+	report, err := Verify(bytes.NewReader(buf), _testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() {
+		t.Fatalf("Verify() problems = %v", report.Problems)
+	}
+
+	if got := report.Tally["room#second"]["a"]; got != 1 {
+		t.Errorf("tally of the second game = %d, want 1", got)
+	}
+}
+
+func TestVerifyIdentities(t *testing.T) {
+	buf := writeLog(t, _testKey,
+		Entry{Kind: KindIdentity, RoomID: "room", Instance: "game", Voter: "alice", Subject: "sub-alice"},
+		Entry{Kind: KindIdentity, RoomID: "room", Instance: "game", Voter: "bob"},
+		vote("game", "alice", "a"),
+	)
+
+	report, err := Verify(bytes.NewReader(buf), _testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Identities != 1 {
+		t.Errorf("Verify() identities = %d, want 1", report.Identities)
+	}
+
+	if len(report.Problems) != 1 {
+		t.Errorf("Verify() problems = %v, want the identity without a subject", report.Problems)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	entries := []Entry{
+		vote("game", "alice", "a"),
+		vote("game", "bob", "b"),
+		tally("game", map[string]int{"a": 1, "b": 1}),
+	}
+
+	// rewrite recomputes every hash of the log without the key, as someone
+	// rewriting the whole file would.
+	rewrite := func(buf []byte) []byte {
+		var out bytes.Buffer
+		prev := GenesisHash
+		for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+			var e Entry
+			json.Unmarshal([]byte(line), &e)
+			if e.Kind == KindVote && e.Voter == "bob" {
+				e.Candidate = "a"
+			}
+
+			e.PrevHash = prev
+			e.Hash, _ = e.computeHash(nil)
+			prev = e.Hash
+			line, _ := json.Marshal(e)
+			out.Write(append(line, '\n'))
+		}
+
+		return out.Bytes()
+	}
+
+	tests := []struct {
+		name   string
+		log    func() []byte
+		key    []byte
+		wantOK bool
+	}{
+		{name: "untouched", log: func() []byte { return writeLog(t, _testKey, entries...) }, key: _testKey, wantOK: true},
+		{name: "wrong key", log: func() []byte { return writeLog(t, _testKey, entries...) }, key: []byte("other")},
+		{name: "rewritten chain", log: func() []byte { return rewrite(writeLog(t, _testKey, entries...)) }, key: _testKey},
+		{name: "edited entry", log: func() []byte {
+			return bytes.Replace(writeLog(t, _testKey, entries...), []byte(`"candidate":"b"`), []byte(`"candidate":"a"`), 1)
+		}, key: _testKey},
+		{name: "dropped entry", log: func() []byte {
+			lines := strings.SplitAfter(string(writeLog(t, _testKey, entries...)), "\n")
+			return []byte(lines[0] + lines[2])
+		}, key: _testKey},
+		{name: "unkeyed log", log: func() []byte { return writeLog(t, nil, entries...) }, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Verify(bytes.NewReader(tt.log()), tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report.OK() != tt.wantOK {
+				t.Errorf("Verify() OK = %v, want %v, problems %v", report.OK(), tt.wantOK, report.Problems)
+			}
+		})
+	}
+}
+
+func TestOpenContinuesChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for _, voter := range []string{"alice", "bob"} {
+		l, err := Open(path, _testKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := l.Append(vote("game", voter, "a")); err != nil {
+			t.Fatal(err)
+		}
+
+		l.Close()
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	report, err := Verify(file, _testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !report.OK() || report.Votes != 2 {
+		t.Errorf("Verify() = %d votes, problems %v, want 2 votes and no problem", report.Votes, report.Problems)
+	}
+}
@@ -3,8 +3,8 @@ package homepage
 import (
 	"net/http"
 
-	"main/internal/keyword"
-	"main/internal/utils"
+	"main/internal/oidc"
+	"main/internal/page"
 
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
@@ -16,9 +16,10 @@ func HomePage() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		w.Write(utils.ReadFile("./internal/resource/homepage.html", map[string]string{
-			keyword.UID:  uuid.NewString(),
-			keyword.Host: viper.GetString("host"),
-		}))
+		page.Render(w, page.HomePage, page.HomePageData{
+			UID:          uuid.NewString(),
+			Host:         viper.GetString("host"),
+			LoginEnabled: oidc.Enabled(),
+		})
 	}
 }
@@ -0,0 +1,68 @@
+package room
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+)
+
+const _passcodeDigits = 6
+
+// generatePasscode returns a random numeric PIN.
+func generatePasscode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < _passcodeDigits; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", _passcodeDigits, n), nil
+}
+
+// AllowInvites restricts the room to the given invite tokens.
+func (r *Room) AllowInvites(tokens []string) {
+	for _, token := range tokens {
+		if len(token) != 0 {
+			r.inviteTokens.Store(token, "")
+		}
+	}
+}
+
+// IsLocked reports whether joining the room requires a passcode or an invite token.
+func (r *Room) IsLocked() bool {
+	return len(r.Passcode) != 0 || r.inviteTokens.Len() != 0
+}
+
+// CheckAccess reports whether uid may join the room with the passcode or invite
+// token. An invite token is bound to the first player using it.
+func (r *Room) CheckAccess(uid, passcode, invite string) bool {
+	if !r.IsLocked() {
+		return true
+	}
+
+	if len(r.Passcode) != 0 && subtle.ConstantTimeCompare([]byte(r.Passcode), []byte(passcode)) == 1 {
+		return true
+	}
+
+	if len(invite) == 0 {
+		return false
+	}
+
+	granted := false
+	r.inviteTokens.Exec(func(m map[string]string) {
+		boundUID, ok := m[invite]
+		if !ok || (len(boundUID) != 0 && boundUID != uid) {
+			return
+		}
+
+		m[invite] = uid
+		granted = true
+	})
+
+	return granted
+}
@@ -0,0 +1,429 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"main/internal/logger"
+	"main/internal/openapi"
+	"main/internal/ratelimit"
+	"main/internal/session"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// CreateRoomAPIRequest creates a room with its candidates and settings. The
+	// room ID is generated when uid is empty.
+	CreateRoomAPIRequest struct {
+		CreateRoomRequest
+		GameSettings
+	}
+
+	// StartRoundRequest starts the round after Round, the current round when
+	// Round is omitted.
+	StartRoundRequest struct {
+		Round *int `json:"round,omitempty"`
+	}
+
+	RoomResponse struct {
+		RoomID        string       `json:"room_id"`
+		Title         string       `json:"title"`
+		State         State        `json:"state"`
+		Round         int          `json:"round"`
+		EndTime       int64        `json:"end_time"`
+		GameOver      bool         `json:"game_over"`
+		Players       int          `json:"players"`
+		PlayersOnline int          `json:"players_online"`
+		Candidates    []*Candidate `json:"candidates"`
+	}
+
+	RoundResponse struct {
+		Round    int   `json:"round"`
+		EndTime  int64 `json:"end_time"`
+		GameOver bool  `json:"game_over"`
+	}
+
+	DashboardResponse struct {
+		Dashboard []*Candidate `json:"dashboard"`
+		Seq       int64        `json:"seq"`
+		GameOver  bool         `json:"game_over"`
+	}
+
+	PlayersResponse struct {
+		Players []PlayerInfo `json:"players"`
+	}
+
+	PlayerInfo struct {
+		Name   string `json:"name"`
+		Online bool   `json:"online"`
+	}
+)
+
+// APIRoutes returns the REST API. It drives rooms through the same Room methods
+// as the host websocket, authenticated with the host token of the room. Room
+// creation is limited by createRoom.
+func APIRoutes(createRoom *ratelimit.Policy) []openapi.Route {
+	return []openapi.Route{
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/rooms",
+			Summary:  "Create a room with its candidates and settings",
+			Request:  CreateRoomAPIRequest{},
+			Response: CreateRoomResponse{},
+			Status:   http.StatusCreated,
+			Handler:  ratelimit.Middleware(createRoom, nil, apiCreateRoom()),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/rooms/{room_id}",
+			Summary:  "Get a room",
+			Auth:     true,
+			Response: RoomResponse{},
+			Handler:  hostAPI(apiGetRoom),
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        "/api/rooms/{room_id}/game",
+			Summary:     "Add or rename candidates and change the settings",
+			Description: "Candidates without an ID are added with new IDs, the ones with an ID are renamed, like the set_game websocket command. An unknown ID fails with 404 and changes nothing. Scores are never changed.",
+			Auth:        true,
+			Request:     GameSettings{},
+			Response:    RoomResponse{},
+			Handler:     hostAPI(apiSetGame),
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/rooms/{room_id}/rounds",
+			Summary:  "Start the next round",
+			Auth:     true,
+			Request:  StartRoundRequest{},
+			Response: RoundResponse{},
+			Handler:  hostAPI(apiStartRound),
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/rooms/{room_id}/rounds/stop",
+			Summary:  "Stop the running round before its countdown is over",
+			Auth:     true,
+			Response: RoundResponse{},
+			Handler:  hostAPI(apiStopRound),
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/rooms/{room_id}/end",
+			Summary:  "End the game and publish the results",
+			Auth:     true,
+			Response: RoundResponse{},
+			Handler:  hostAPI(apiEndGame),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/rooms/{room_id}/dashboard",
+			Summary:  "Get the dashboard",
+			Auth:     true,
+			Response: DashboardResponse{},
+			Handler:  hostAPI(apiGetDashboard),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/rooms/{room_id}/players",
+			Summary:  "List the players",
+			Auth:     true,
+			Response: PlayersResponse{},
+			Handler:  hostAPI(apiGetPlayers),
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/rooms/{room_id}/results",
+			Summary:  "Get the results of a finished game",
+			Auth:     true,
+			Query:    []openapi.Param{{Name: "anonymize", Description: "Replace the voters with pseudonyms.", Type: "boolean"}},
+			Response: Results{},
+			Handler:  hostAPI(apiGetResults),
+		},
+	}
+}
+
+// APISpec returns the OpenAPI document of routes.
+func APISpec(routes []openapi.Route) map[string]any {
+	return openapi.Spec("vote", strconv.Itoa(_protocolVersion), routes, Error{})
+}
+
+func apiCreateRoom() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		if IsDraining() {
+			writeAPIError(w, http.StatusServiceUnavailable, errors.New("server restarting"))
+
+			return
+		}
+
+		var request CreateRoomAPIRequest
+		if err := readJSON(r, &request); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+
+			return
+		}
+
+		if len(request.UID) == 0 {
+			request.UID = uuid.NewString()
+		}
+
+		l.Info("apiCreateRoom", "request", request.CreateRoomRequest)
+
+		room, status, err := openRoom(&request.CreateRoomRequest)
+		if err != nil {
+			writeAPIError(w, status, err)
+
+			return
+		}
+
+		// HINT: no host websocket will open the room, it's driven through the API.
+		room.advance(StateOpen)
+		if err := room.SetGame(&request.GameSettings); err != nil {
+			room.Delete()
+			writeAPIError(w, apiStatus(err), err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, CreateRoomResponse{
+			RoomID:    room.RoomID,
+			Passcode:  room.Passcode,
+			HostToken: session.HostToken(room.RoomID),
+		})
+	}
+}
+
+// hostAPI loads the room of the request and checks the host token. Requests
+// changing the room are refused once it's closed or the server is draining.
+func hostAPI(fn func(w http.ResponseWriter, r *http.Request, room *Room)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		roomID := r.PathValue("room_id")
+		room, ok := _roomPool.Load(roomID)
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, errors.New("room not found"))
+
+			return
+		}
+
+		if !session.VerifyHost(r, room.RoomID) {
+			l.Warn("hostAPI, host token is invalid", "room_id", roomID)
+			writeAPIError(w, http.StatusUnauthorized, errors.New("host token is invalid"))
+
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			if room.IsClosed() {
+				writeAPIError(w, http.StatusGone, errors.New("room closed"))
+
+				return
+			}
+
+			if IsDraining() {
+				writeAPIError(w, http.StatusServiceUnavailable, errors.New("server restarting"))
+
+				return
+			}
+		}
+
+		fn(w, r, room)
+	}
+}
+
+func apiGetRoom(w http.ResponseWriter, _ *http.Request, room *Room) {
+	writeJSON(w, http.StatusOK, room.info())
+}
+
+func apiSetGame(w http.ResponseWriter, r *http.Request, room *Room) {
+	var settings GameSettings
+	if err := readJSON(r, &settings); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	if err := room.SetGame(&settings); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, room.info())
+}
+
+func apiStartRound(w http.ResponseWriter, r *http.Request, room *Room) {
+	var request StartRoundRequest
+	if err := readJSON(r, &request); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	round := room.Round.Load()
+	if request.Round != nil {
+		round = *request.Round
+	}
+
+	if err := room.PlayRound(&RoundCommand{Round: round, Start: true}); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, room.roundInfo())
+}
+
+func apiStopRound(w http.ResponseWriter, _ *http.Request, room *Room) {
+	if err := room.StopRound(); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, room.roundInfo())
+}
+
+func apiEndGame(w http.ResponseWriter, _ *http.Request, room *Room) {
+	if err := room.PlayRound(&RoundCommand{Round: room.Round.Load(), GameOver: true}); err != nil {
+		writeAPIError(w, apiStatus(err), err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, room.roundInfo())
+}
+
+func apiGetDashboard(w http.ResponseWriter, _ *http.Request, room *Room) {
+	dashboard, seq := room.GetDashboard()
+	writeJSON(w, http.StatusOK, DashboardResponse{
+		Dashboard: dashboard,
+		Seq:       seq,
+		GameOver:  room.IsGameOver.Load(),
+	})
+}
+
+func apiGetPlayers(w http.ResponseWriter, _ *http.Request, room *Room) {
+	players := []PlayerInfo{}
+	for _, player := range room.playerTable.ValueSlice() {
+		players = append(players, PlayerInfo{Name: player.Name, Online: player.Online.Load()})
+	}
+
+	writeJSON(w, http.StatusOK, PlayersResponse{Players: players})
+}
+
+func apiGetResults(w http.ResponseWriter, r *http.Request, room *Room) {
+	res, ok := room.Results()
+	if !ok {
+		writeAPIError(w, http.StatusConflict, errors.New("results are exported after the game is over"))
+
+		return
+	}
+
+	if anonymize, _ := strconv.ParseBool(r.URL.Query().Get("anonymize")); anonymize {
+		res = res.anonymized()
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (r *Room) info() RoomResponse {
+	online := 0
+	players := r.playerTable.ValueSlice()
+	for _, player := range players {
+		if player.Online.Load() {
+			online++
+		}
+	}
+
+	return RoomResponse{
+		RoomID:        r.RoomID,
+		Title:         r.Title,
+		State:         r.State(),
+		Round:         r.Round.Load(),
+		EndTime:       r.RoundEndTime.Load(),
+		GameOver:      r.IsGameOver.Load(),
+		Players:       len(players),
+		PlayersOnline: online,
+		Candidates:    r.GetCandidates(),
+	}
+}
+
+func (r *Room) roundInfo() RoundResponse {
+	return RoundResponse{
+		Round:    r.Round.Load(),
+		EndTime:  r.RoundEndTime.Load(),
+		GameOver: r.IsGameOver.Load(),
+	}
+}
+
+// readJSON decodes the body of r into v, an empty body leaves v untouched.
+func readJSON(r *http.Request, v any) error {
+	buf, err := io.ReadAll(r.Body)
+	if err != nil || len(buf) == 0 {
+		return err
+	}
+
+	return json.Unmarshal(buf, v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// writeAPIError replies err as an Error body, errors which are not an Error get
+// a code derived from status.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		code, ok := _statusCodes[status]
+		if !ok {
+			code = ErrorCodeInternal
+		}
+
+		e = &Error{Code: code, Message: err.Error()}
+	}
+
+	body, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+var _statusCodes = map[int]ErrorCode{
+	http.StatusBadRequest:         ErrorCodeBadRequest,
+	http.StatusUnauthorized:       ErrorCodeUnauthorized,
+	http.StatusNotFound:           ErrorCodeNotFound,
+	http.StatusConflict:           ErrorCodeConflict,
+	http.StatusGone:               ErrorCodeRoomClosed,
+	http.StatusServiceUnavailable: ErrorCodeUnavailable,
+}
+
+// apiStatus maps the errors of the Room methods to HTTP statuses.
+func apiStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrCandidateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRoundMismatch), errors.Is(err, ErrGameOver), errors.Is(err, ErrNoRunningRound):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,88 @@
+package room
+
+import (
+	"errors"
+
+	"main/internal/audit"
+)
+
+// auditVote appends an accepted vote to the audit log. It must be called with
+// the dashboard locked, so the log follows the order the scores changed in.
+func (r *Room) auditVote(uid string, round int, candidate string) {
+	r.appendAudit(audit.Entry{
+		Kind:      audit.KindVote,
+		RoomID:    r.RoomID,
+		Instance:  r.instance,
+		Round:     round,
+		Voter:     audit.Pseudonym(r.RoomID, uid),
+		Candidate: candidate,
+		Accepted:  true,
+	})
+}
+
+// auditIdentity appends the subject bound to uid to the audit log, so an
+// auditor can tell who cast the votes of its pseudonym.
+func (r *Room) auditIdentity(uid, subject string) {
+	r.appendAudit(audit.Entry{
+		Kind:     audit.KindIdentity,
+		RoomID:   r.RoomID,
+		Instance: r.instance,
+		Voter:    audit.Pseudonym(r.RoomID, uid),
+		Subject:  subject,
+	})
+}
+
+// auditRejected appends a vote which was not counted to the audit log.
+func (r *Room) auditRejected(uid string, round int, candidate string, vote *Vote, err error) {
+	reason := "duplicate"
+	if err != nil {
+		reason = string(ErrorCodeInternal)
+		var e *Error
+		if errors.As(err, &e) {
+			reason = string(e.Code)
+		}
+	}
+
+	if vote != nil && vote.Duplicate {
+		round, candidate = vote.Round, vote.Candidate
+	}
+
+	r.appendAudit(audit.Entry{
+		Kind:      audit.KindVote,
+		RoomID:    r.RoomID,
+		Instance:  r.instance,
+		Round:     round,
+		Voter:     audit.Pseudonym(r.RoomID, uid),
+		Candidate: candidate,
+		Reason:    reason,
+	})
+}
+
+// auditTally appends the current dashboard to the audit log, so a replay of the
+// votes before it can be checked against it.
+func (r *Room) auditTally() {
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		if len(m) == 0 {
+			return
+		}
+
+		tally := make(map[string]int, len(m))
+		for id, c := range m {
+			tally[id] = c.Score
+		}
+
+		r.appendAudit(audit.Entry{
+			Kind:     audit.KindTally,
+			RoomID:   r.RoomID,
+			Instance: r.instance,
+			Round:    r.Round.Load(),
+			Tally:    tally,
+		})
+	})
+}
+
+func (r *Room) appendAudit(e audit.Entry) {
+	if err := audit.Default().Append(e); err != nil {
+		r.l.Error("audit.Append", "error", err)
+	}
+}
@@ -0,0 +1,99 @@
+package room
+
+import (
+	"context"
+	"time"
+)
+
+// BroadcastStats counts how dashboard changes were turned into delta broadcasts.
+type BroadcastStats struct {
+	// Updates is the number of dashboard changes queued for broadcasting.
+	Updates int64
+	// Broadcasts is the number of delta messages sent.
+	Broadcasts int64
+	// Coalesced is the number of changes merged into another change's broadcast.
+	Coalesced int64
+}
+
+// runBroadcaster sends the queued dashboard changes once per interval, so a
+// burst of votes costs one message per client instead of one per vote.
+func (r *Room) runBroadcaster(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.flushDashboardDelta()
+		}
+	}
+}
+
+// markDashboardDelta queues a changed candidate for the next broadcast.
+// It must be called while the dashboard is locked.
+func (r *Room) markDashboardDelta(candidateID string) {
+	r.pendingDelta[candidateID]++
+	r.broadcastStats.Updates++
+}
+
+// flushDashboardDelta broadcasts the queued changes. The broadcaster and Drain
+// both flush, the flushes are serialized so clients get the deltas in seq order.
+func (r *Room) flushDashboardDelta() {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	var (
+		seq       int64
+		changed   []*Candidate
+		coalesced int64
+	)
+
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		if len(r.pendingDelta) == 0 {
+			return
+		}
+
+		var updates int64
+		changed = make([]*Candidate, 0, len(r.pendingDelta))
+		for id, count := range r.pendingDelta {
+			if c, ok := m[id]; ok {
+				cp := *c
+				changed = append(changed, &cp)
+				updates += int64(count)
+			}
+		}
+
+		r.pendingDelta = map[string]int{}
+		if len(changed) == 0 {
+			return
+		}
+
+		coalesced = updates - 1
+		r.broadcastStats.Broadcasts++
+		r.broadcastStats.Coalesced += coalesced
+		seq = r.nextDashboardSeq()
+	})
+
+	if len(changed) == 0 {
+		return
+	}
+
+	if coalesced > 0 {
+		r.l.Debug("dashboard delta", "seq", seq, "coalesced", coalesced)
+	}
+
+	r.BroadcastDashboardDelta(seq, changed)
+}
+
+// BroadcastStats returns the broadcast counters of the room, exported by the
+// room collector.
+func (r *Room) BroadcastStats() BroadcastStats {
+	var stats BroadcastStats
+	r.dashboard.Exec(func(map[string]*Candidate) {
+		stats = r.broadcastStats
+	})
+
+	return stats
+}
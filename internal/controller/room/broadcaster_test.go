@@ -0,0 +1,111 @@
+package room
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBroadcastPlayersSkipsFullQueues(t *testing.T) {
+	r := NewRoom("test-broadcast", "broadcast")
+	defer r.Close()
+
+	offline, online := NewPlayer("offline", "offline"), NewPlayer("online", "online")
+	r.AddPlayer(offline)
+	r.AddPlayer(online)
+	for len(offline.Channel) < cap(offline.Channel) {
+		offline.Channel <- PlayerWsMessageOutgoing{}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.BroadcastPlayers(PlayerWsMessageOutgoing{Type: MessageTypeDashboard})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("BroadcastPlayers() blocked on a full player queue")
+	}
+
+	if got := r.droppedMessages.Load(); got != 1 {
+		t.Errorf("dropped messages = %d, want 1", got)
+	}
+
+	if msg := <-online.Channel; msg.Type != MessageTypeDashboard {
+		t.Errorf("online player got %q, want %q", msg.Type, MessageTypeDashboard)
+	}
+}
+
+func TestRepliesSkipFullQueues(t *testing.T) {
+	r := NewRoom("test-replies", "replies")
+	defer r.Close()
+
+	player := NewPlayer("player", "player")
+	r.AddPlayer(player)
+	for len(player.Channel) < cap(player.Channel) {
+		player.Channel <- PlayerWsMessageOutgoing{}
+	}
+
+	for len(r.HostMsg) < cap(r.HostMsg) {
+		r.HostMsg <- HostWsMessageOutgoing{}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		player.handlePlayerIncomingMessage(player.l, r, PlayerWsMessageIncoming{Version: _protocolVersion + 1})
+		player.handlePlayerConnect(r)
+		(&Host{l: r.l}).handleHostIncomingMessage(r, HostWsMessageIncoming{Version: _protocolVersion + 1})
+		(&Host{l: r.l}).handleConnect(r)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a reply blocked on a full queue")
+	}
+}
+
+func TestFlushDashboardDeltaInOrder(t *testing.T) {
+	r := NewRoom("test-flush-order", "flush order")
+	defer r.Close()
+
+	r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}}})
+	player := NewPlayer("player", "player")
+	r.AddPlayer(player)
+	// HINT: more players widen the window between taking a seq and sending it.
+	for i := 0; i < 100; i++ {
+		r.AddPlayer(NewPlayer(fmt.Sprint("other-", i), "other"))
+	}
+	id := r.GetCandidates()[0].ID
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				r.dashboard.Exec(func(map[string]*Candidate) { r.markDashboardDelta(id) })
+				r.flushDashboardDelta()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var last int64
+	for len(player.Channel) != 0 {
+		msg := <-player.Channel
+		if msg.DashboardDelta == nil {
+			continue
+		}
+
+		if msg.DashboardDelta.Seq <= last {
+			t.Fatalf("delta seq %d after %d", msg.DashboardDelta.Seq, last)
+		}
+
+		last = msg.DashboardDelta.Seq
+	}
+}
@@ -2,22 +2,57 @@ package room
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+
+	"main/internal/logger"
+	"main/internal/oidc"
+	"main/internal/session"
+	"main/internal/webhook"
 )
 
 type CreateRoomRequest struct {
-	UID       string `json:"uid"`
-	RoomTitle string `json:"room_title"`
+	UID          string   `json:"uid"`
+	RoomTitle    string   `json:"room_title"`
+	Passcode     bool     `json:"passcode"`
+	InviteTokens []string `json:"invite_tokens"`
+	RequireLogin bool     `json:"require_login"`
+	AuditVoters  bool     `json:"audit_voters"`
+	// Webhooks are posted the events of the room.
+	Webhooks []webhook.Endpoint `json:"webhooks"`
+}
+
+// LogValue keeps the invite tokens and webhook secrets out of the logs.
+func (c CreateRoomRequest) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("uid", c.UID),
+		slog.String("room_title", c.RoomTitle),
+		slog.Bool("passcode", c.Passcode),
+		slog.Int("invite_tokens", len(c.InviteTokens)),
+		slog.Bool("require_login", c.RequireLogin),
+		slog.Bool("audit_voters", c.AuditVoters),
+		slog.Int("webhooks", len(c.Webhooks)),
+	)
 }
 
 type CreateRoomResponse struct {
-	RoomID string `json:"room_id"`
+	RoomID    string `json:"room_id"`
+	Passcode  string `json:"passcode,omitempty"`
+	HostToken string `json:"host_token"`
 }
 
 func CreateRoom() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		if IsDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("server restarting"))
+
+			return
+		}
+
 		buf, err := io.ReadAll(r.Body)
 		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
@@ -34,14 +69,20 @@ func CreateRoom() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		slog.Info("CreateRoom", "request", request)
+		l.Info("CreateRoom", "request", request)
 
-		room := NewRoom(request.UID, request.RoomTitle)
+		room, status, err := openRoom(&request)
+		if err != nil {
+			w.WriteHeader(status)
+			w.Write([]byte(err.Error()))
 
-		_roomPool.Store(room.RoomID, room)
+			return
+		}
 
 		response, err := json.Marshal(CreateRoomResponse{
-			RoomID: room.RoomID,
+			RoomID:    room.RoomID,
+			Passcode:  room.Passcode,
+			HostToken: session.HostToken(room.RoomID),
 		})
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -50,6 +91,64 @@ func CreateRoom() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		session.IssueHost(w, room.RoomID)
 		w.Write(response)
 	}
 }
+
+// openRoom creates the room of request and adds it to the pool. A live room
+// with the same ID is never replaced, the room ID is public in every join URL.
+// The returned status is the one to reply on error.
+func openRoom(request *CreateRoomRequest) (*Room, int, error) {
+	if request.RequireLogin && !oidc.Enabled() {
+		return nil, http.StatusBadRequest, errors.New("login is not configured")
+	}
+
+	if err := webhook.Validate(request.Webhooks); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	room := NewRoom(request.UID, request.RoomTitle)
+	if request.Passcode {
+		passcode, err := generatePasscode()
+		if err != nil {
+			room.Close()
+
+			return nil, http.StatusInternalServerError, err
+		}
+
+		room.Passcode = passcode
+	}
+
+	room.AllowInvites(request.InviteTokens)
+	room.RequireLogin = request.RequireLogin
+	room.AuditVoters = request.RequireLogin && request.AuditVoters
+	room.hooks = webhook.New(room.l, room.RoomID, request.Webhooks)
+
+	if !addRoom(room) {
+		room.Close()
+		room.hooks.Close()
+
+		return nil, http.StatusConflict, errors.New("room already exists")
+	}
+
+	room.hooks.Fire(webhook.EventRoomCreated, RoomCreatedEvent{Title: room.Title})
+
+	return room, 0, nil
+}
+
+// addRoom adds room to the pool unless a live room has its ID. An archived room
+// only keeps its results, and gives its ID to the new room.
+func addRoom(room *Room) bool {
+	added := false
+	_roomPool.Exec(func(m map[string]*Room) {
+		if old, ok := m[room.RoomID]; ok && !old.IsClosed() {
+			return
+		}
+
+		m[room.RoomID] = room
+		added = true
+	})
+
+	return added
+}
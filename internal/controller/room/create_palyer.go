@@ -3,28 +3,49 @@ package room
 import (
 	"encoding/json"
 	"io"
-	"log/slog"
 	"net/http"
+
+	"main/internal/logger"
+	"main/internal/session"
+	"main/internal/webhook"
 )
 
 type CreatePlayerRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Passcode string `json:"passcode"`
+	Invite   string `json:"invite"`
 }
 
 func CreatePlayer() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		slog.Info("CreatePlayer", "room_id", r.PathValue("room_id"), "uid", r.PathValue("uid"))
+		l := logger.FromContext(r.Context())
+		l.Info("CreatePlayer", "room_id", r.PathValue("room_id"), "uid", r.PathValue("uid"))
+
+		if IsDraining() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("server restarting"))
+
+			return
+		}
 		room, ok := _roomPool.Load(r.PathValue("room_id"))
 		if !ok {
-			slog.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
+			l.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
 			w.Write([]byte("room not found"))
 
 			return
 		}
 
+		if room.IsClosed() {
+			l.Warn("CreatePlayer, room closed", "room_id", room.RoomID)
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("room closed"))
+
+			return
+		}
+
 		uid := r.PathValue("uid")
 		if len(uid) == 0 {
-			slog.Warn("GetRoom, uid not found in path", "uid", uid)
+			l.Warn("GetRoom, uid not found in path", "uid", uid)
 			w.WriteHeader(http.StatusBadRequest)
 
 			return
@@ -32,7 +53,7 @@ func CreatePlayer() func(w http.ResponseWriter, r *http.Request) {
 
 		buf, err := io.ReadAll(r.Body)
 		if err != nil {
-			slog.Warn("GetRoom, read body err", "err", err)
+			l.Warn("GetRoom, read body err", "err", err)
 			w.WriteHeader(http.StatusBadRequest)
 
 			return
@@ -40,19 +61,59 @@ func CreatePlayer() func(w http.ResponseWriter, r *http.Request) {
 
 		var req CreatePlayerRequest
 		if err := json.Unmarshal(buf, &req); err != nil {
-			slog.Warn("GetRoom, unmarshal err", "err", err)
+			l.Warn("GetRoom, unmarshal err", "err", err)
 			w.WriteHeader(http.StatusBadRequest)
 
 			return
 		}
 
 		if len(req.Name) == 0 {
-			slog.Warn("GetRoom, name not found in request", "name", req.Name)
+			l.Warn("GetRoom, name not found in request", "name", req.Name)
 			w.WriteHeader(http.StatusBadRequest)
 
 			return
 		}
 
-		room.AddPlayer(NewPlayer(uid, req.Name))
+		if _, exist := room.GetPlayer(uid); exist {
+			if !session.Verify(r, room.RoomID, uid) {
+				l.Warn("CreatePlayer, player exists and session is invalid", "uid", uid)
+				w.WriteHeader(http.StatusForbidden)
+
+				return
+			}
+
+			session.Issue(w, room.RoomID, uid)
+
+			return
+		}
+
+		if !room.CheckAccess(uid, req.Passcode, req.Invite) {
+			l.Warn("CreatePlayer, passcode or invite token rejected", "room_id", room.RoomID, "uid", uid)
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		if room.RequireLogin {
+			subject, ok := session.Identity(r, room.RoomID)
+			if !ok {
+				l.Warn("CreatePlayer, login required", "room_id", room.RoomID, "uid", uid)
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			if !room.BindSubject(uid, subject) {
+				l.Warn("CreatePlayer, subject already joined", "room_id", room.RoomID, "uid", uid)
+				w.WriteHeader(http.StatusConflict)
+
+				return
+			}
+		}
+
+		player := NewPlayer(uid, req.Name)
+		room.AddPlayer(player)
+		room.hooks.Fire(webhook.EventPlayerJoined, PlayerJoinedEvent{Name: player.Name, Players: room.playerTable.Len()})
+		session.Issue(w, room.RoomID, uid)
 	}
 }
@@ -0,0 +1,33 @@
+package room
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOpenRoomKeepsLiveRoom(t *testing.T) {
+	first, _, err := openRoom(&CreateRoomRequest{UID: "test-open-room", RoomTitle: "first"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Delete()
+
+	if _, status, err := openRoom(&CreateRoomRequest{UID: "test-open-room", RoomTitle: "second"}); err == nil || status != http.StatusConflict {
+		t.Fatalf("openRoom() of a live room = %d, %v, want %d", status, err, http.StatusConflict)
+	}
+
+	if current, _ := _roomPool.Load("test-open-room"); current != first {
+		t.Fatal("openRoom() replaced the live room")
+	}
+
+	first.Archive()
+	second, _, err := openRoom(&CreateRoomRequest{UID: "test-open-room", RoomTitle: "second"})
+	if err != nil {
+		t.Fatalf("openRoom() of an archived room: %v", err)
+	}
+	defer second.Delete()
+
+	if current, _ := _roomPool.Load("test-open-room"); current != second {
+		t.Fatal("openRoom() kept the archived room")
+	}
+}
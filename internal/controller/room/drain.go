@@ -0,0 +1,106 @@
+package room
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"main/internal/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// _drainGrace is how long the restart notice gets to reach the clients before
+// their sockets are closed.
+const _drainGrace = 500 * time.Millisecond
+
+// closeReason is the websocket close frame sent when a room stops.
+type closeReason struct {
+	Code int
+	Text string
+}
+
+func (c *closeReason) Error() string {
+	return c.Text
+}
+
+var (
+	_reasonArchived   = &closeReason{Code: _closeArchived, Text: "room archived"}
+	_reasonRestarting = &closeReason{Code: websocket.CloseServiceRestart, Text: "server restarting"}
+)
+
+var (
+	_draining    = utils.NewSyncValue(false)
+	_connections sync.WaitGroup
+)
+
+// IsDraining reports whether the server is shutting down and accepts no new rooms or players.
+func IsDraining() bool {
+	return _draining.Load()
+}
+
+// Drain stops accepting new rooms and players, records the dashboards in the
+// audit log, and sends the pending dashboard updates and a restart notice to
+// every host and player before closing all websockets. Rooms live in memory
+// only, the audit log is all that outlives the restart. It returns when the
+// sockets are closed or ctx is done.
+func Drain(ctx context.Context) {
+	_draining.Store(true)
+
+	rooms := _roomPool.ValueSlice()
+	for _, room := range rooms {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if room.IsClosed() {
+			continue
+		}
+
+		// HINT: broadcasts never block, a full queue can't hold up the shutdown.
+		room.flushDashboardDelta()
+		room.auditTally()
+		room.notifyRestart()
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(_drainGrace):
+	}
+
+	for _, room := range rooms {
+		room.stop(_reasonRestarting)
+		room.hooks.Close()
+		for _, player := range room.playerTable.ValueSlice() {
+			player.closeSession(_reasonRestarting.Code, _reasonRestarting.Text)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		_connections.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
+
+func (r *Room) notifyRestart() {
+	notice := &RestartNotice{Message: _reasonRestarting.Text}
+	r.BroadcastPlayers(PlayerWsMessageOutgoing{
+		Version:   _protocolVersion,
+		Type:      MessageTypeRestart,
+		Restart:   notice,
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	r.sendHost(HostWsMessageOutgoing{
+		Version:   _protocolVersion,
+		Type:      MessageTypeRestart,
+		Restart:   notice,
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
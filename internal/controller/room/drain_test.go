@@ -0,0 +1,36 @@
+package room
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrainWithFullPlayerQueue(t *testing.T) {
+	defer _draining.Store(false)
+
+	room, _, err := openRoom(&CreateRoomRequest{UID: "test-drain", RoomTitle: "drain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.Delete()
+
+	player := NewPlayer("stuck", "stuck")
+	room.AddPlayer(player)
+	for len(player.Channel) < cap(player.Channel) {
+		player.Channel <- PlayerWsMessageOutgoing{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	Drain(ctx)
+	if ctx.Err() != nil {
+		t.Fatalf("Drain() took %s, until the shutdown timeout", time.Since(start))
+	}
+
+	if !IsDraining() {
+		t.Error("IsDraining() = false after Drain()")
+	}
+}
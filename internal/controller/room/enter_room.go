@@ -3,11 +3,12 @@ package room
 import (
 	"bytes"
 	"encoding/base64"
-	"log/slog"
+	"html/template"
 	"net/http"
 
-	"main/internal/keyword"
-	"main/internal/utils"
+	"main/internal/logger"
+	"main/internal/page"
+	"main/internal/session"
 
 	"github.com/spf13/viper"
 	"github.com/yeqown/go-qrcode"
@@ -15,48 +16,73 @@ import (
 
 func EnterRoom() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
 		room, ok := _roomPool.Load(r.PathValue("room_id"))
 		if !ok {
-			slog.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
+			l.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
 			w.Write([]byte("room not found"))
 
 			return
 		}
 
+		if room.IsClosed() {
+			l.Warn("EnterRoom, room closed", "room_id", room.RoomID)
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("room closed"))
+
+			return
+		}
+
 		if r.PathValue("uid") != room.RoomID {
-			slog.Info("EnterRoom, player", "uid", r.PathValue("uid"))
+			l.Info("EnterRoom, player", "uid", r.PathValue("uid"))
+			if !session.Verify(r, room.RoomID, r.PathValue("uid")) {
+				l.Warn("EnterRoom, session invalid", "uid", r.PathValue("uid"))
+				http.Redirect(w, r, viper.GetString("host")+"/vote/"+room.RoomID, http.StatusSeeOther)
+
+				return
+			}
+
 			// HINT: Player's Page
-			w.Write(utils.ReadFile("./internal/resource/player.html", map[string]string{
-				keyword.Host:      viper.GetString("host"),
-				keyword.Wss:       viper.GetString("wss"),
-				keyword.RoomID:    room.RoomID,
-				keyword.RoomTitle: room.Title,
-			}))
+			page.Render(w, page.Player, page.PlayerData{
+				Host:      viper.GetString("host"),
+				Wss:       viper.GetString("wss"),
+				RoomID:    room.RoomID,
+				RoomTitle: room.Title,
+			})
+			return
+		}
+
+		// HINT: the host page shows the passcode, the room ID alone is in every join link.
+		if !session.VerifyHost(r, room.RoomID) {
+			l.Warn("EnterRoom, host session invalid", "room_id", room.RoomID)
+			http.Redirect(w, r, viper.GetString("host")+"/vote/"+room.RoomID, http.StatusSeeOther)
+
 			return
 		}
 
 		url := viper.GetString("host") + "/vote/" + room.RoomID
 		qrc, err := qrcode.New(url, qrcode.WithQRWidth(10))
 		if err != nil {
-			slog.Error("qrcode.New", "error", err)
+			l.Error("qrcode.New", "error", err)
 			return
 		}
 
 		qr := bytes.NewBuffer(nil)
 		if err := qrc.SaveTo(qr); err != nil {
-			slog.Error("qrcode.SaveTo", "error", err)
+			l.Error("qrcode.SaveTo", "error", err)
 			return
 		}
 
 		// HINT: Host's Page
-		qrcImg := base64.StdEncoding.EncodeToString(qr.Bytes())
-		w.Write(utils.ReadFile("./internal/resource/host.html", map[string]string{
-			keyword.QRCode:    qrcImg,
-			keyword.Host:      viper.GetString("host"),
-			keyword.Wss:       viper.GetString("wss"),
-			keyword.RoomLink:  url,
-			keyword.RoomID:    room.RoomID,
-			keyword.RoomTitle: room.Title,
-		}))
+		qrcImg := "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes())
+		page.Render(w, page.Host, page.HostData{
+			QRCode:       template.URL(qrcImg),
+			RoomPasscode: room.Passcode,
+			Host:         viper.GetString("host"),
+			Wss:          viper.GetString("wss"),
+			RoomLink:     url,
+			RoomID:       room.RoomID,
+			RoomTitle:    room.Title,
+		})
 	}
 }
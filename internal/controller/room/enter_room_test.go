@@ -0,0 +1,60 @@
+package room
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"main/internal/session"
+)
+
+func TestEnterRoomHostRequiresHostToken(t *testing.T) {
+	room, _, err := openRoom(&CreateRoomRequest{UID: "test-enter-host", RoomTitle: "enter host", Passcode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.Delete()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vote/{room_id}/{uid}", EnterRoom())
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "no token", want: http.StatusSeeOther},
+		{name: "player session", token: session.Sign("test-enter-host", "test-enter-host", 0), want: http.StatusSeeOther},
+		{name: "other room", token: session.HostToken("other-room"), want: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/vote/test-enter-host/test-enter-host", nil)
+			if len(tt.token) != 0 {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("EnterRoom() status = %d, want %d", rec.Code, tt.want)
+			}
+
+			if strings.Contains(rec.Body.String(), room.Passcode) {
+				t.Error("EnterRoom() shows the passcode without the host token")
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/vote/test-enter-host/test-enter-host", nil)
+	req.Header.Set("Authorization", "Bearer "+session.HostToken("test-enter-host"))
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code == http.StatusSeeOther {
+		t.Error("EnterRoom() redirected the host")
+	}
+}
@@ -0,0 +1,324 @@
+package room
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"main/internal/audit"
+	"main/internal/logger"
+	"main/internal/session"
+)
+
+// Results is the snapshot of a room taken when the game is over. It is kept
+// after the room is archived, so the results can be exported until it is deleted.
+type Results struct {
+	RoomID     string         `json:"room_id"`
+	Title      string         `json:"title"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Rounds     int            `json:"rounds"`
+	Players    int            `json:"players"`
+	Candidates []*Candidate   `json:"candidates"`
+	Tallies    []RoundTally   `json:"tallies"`
+	Ballots    []ResultBallot `json:"ballots"`
+	Anonymized bool           `json:"anonymized"`
+	candidates map[string]*Candidate
+}
+
+// RoundTally is the votes of a round. Turnout is the share of the players who
+// voted in the round.
+type RoundTally struct {
+	Round   int            `json:"round"`
+	Voters  int            `json:"voters"`
+	Turnout float64        `json:"turnout"`
+	Votes   map[string]int `json:"votes"`
+}
+
+// ResultBallot is the choice of a player in a round. Voter is a pseudonym and
+// VoterName is empty in an anonymized export.
+type ResultBallot struct {
+	Round     int    `json:"round"`
+	Voter     string `json:"voter"`
+	VoterName string `json:"voter_name,omitempty"`
+	Candidate string `json:"candidate"`
+	Receipt   string `json:"receipt"`
+}
+
+// recordResults takes the results snapshot of the room.
+func (r *Room) recordResults() {
+	candidates := r.GetCandidates()
+	res := &Results{
+		RoomID:     r.RoomID,
+		Title:      r.Title,
+		FinishedAt: time.Now(),
+		Rounds:     r.Round.Load(),
+		Candidates: make([]*Candidate, 0, len(candidates)),
+		Tallies:    make([]RoundTally, 0, r.Round.Load()),
+		Ballots:    []ResultBallot{},
+		candidates: make(map[string]*Candidate, len(candidates)),
+	}
+
+	for _, c := range candidates {
+		cp := *c
+		res.Candidates = append(res.Candidates, &cp)
+		res.candidates[cp.ID] = &cp
+	}
+
+	players := r.playerTable.ValueSlice()
+	res.Players = len(players)
+	for _, player := range players {
+		player.VoteTable.Exec(func(m map[int]Ballot) {
+			for round, ballot := range m {
+				if len(ballot.Candidate) == 0 {
+					continue
+				}
+
+				res.Ballots = append(res.Ballots, ResultBallot{
+					Round:     round,
+					Voter:     player.UID,
+					VoterName: player.Name,
+					Candidate: ballot.Candidate,
+					Receipt:   ballot.Receipt,
+				})
+			}
+		})
+	}
+
+	sort.Slice(res.Ballots, func(i, j int) bool {
+		if res.Ballots[i].Round != res.Ballots[j].Round {
+			return res.Ballots[i].Round < res.Ballots[j].Round
+		}
+
+		return res.Ballots[i].Voter < res.Ballots[j].Voter
+	})
+
+	for round := 1; round <= res.Rounds; round++ {
+		tally := RoundTally{Round: round, Votes: map[string]int{}}
+		for _, c := range res.Candidates {
+			tally.Votes[c.ID] = 0
+		}
+
+		for _, b := range res.Ballots {
+			if b.Round == round {
+				tally.Voters++
+				tally.Votes[b.Candidate]++
+			}
+		}
+
+		if res.Players != 0 {
+			tally.Turnout = float64(tally.Voters) / float64(res.Players)
+		}
+
+		res.Tallies = append(res.Tallies, tally)
+	}
+
+	r.results.Store(res)
+}
+
+// Results returns the results snapshot, and false before the game is over.
+func (r *Room) Results() (*Results, bool) {
+	res := r.results.Load()
+
+	return res, res != nil
+}
+
+// anonymized returns a copy of the results whose ballots carry the audit log
+// pseudonyms of the voters instead of their IDs and names.
+func (res *Results) anonymized() *Results {
+	cp := *res
+	cp.Anonymized = true
+	cp.Ballots = make([]ResultBallot, len(res.Ballots))
+	for i, b := range res.Ballots {
+		b.Voter = audit.Pseudonym(res.RoomID, b.Voter)
+		b.VoterName = ""
+		cp.Ballots[i] = b
+	}
+
+	sort.SliceStable(cp.Ballots, func(i, j int) bool {
+		if cp.Ballots[i].Round != cp.Ballots[j].Round {
+			return cp.Ballots[i].Round < cp.Ballots[j].Round
+		}
+
+		return cp.Ballots[i].Voter < cp.Ballots[j].Voter
+	})
+
+	return &cp
+}
+
+func (res *Results) candidateName(id string) string {
+	if c, ok := res.candidates[id]; ok {
+		return c.Name
+	}
+
+	return ""
+}
+
+// ExportResults serves the results of a finished game to its host. The format
+// query parameter is csv, json or md; csv exports one table, chosen by the table
+// query parameter: room, candidates, tallies (default) or ballots. Ballots are
+// pseudonymized with anonymize=true.
+func ExportResults() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		roomID := r.PathValue("room_id")
+		room, ok := _roomPool.Load(roomID)
+		if !ok {
+			l.Warn("room not found", "room_id", roomID)
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if !session.VerifyHost(r, room.RoomID) {
+			l.Warn("ExportResults, host token is invalid", "room_id", roomID)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		res, ok := room.Results()
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("results are exported after the game is over"))
+
+			return
+		}
+
+		query := r.URL.Query()
+		if anonymize, _ := strconv.ParseBool(query.Get("anonymize")); anonymize {
+			res = res.anonymized()
+		}
+
+		var (
+			buf         bytes.Buffer
+			err         error
+			contentType string
+			ext         string
+		)
+
+		switch format := query.Get("format"); format {
+		case "", "json":
+			contentType, ext = "application/json", "json"
+			err = json.NewEncoder(&buf).Encode(res)
+		case "csv":
+			contentType, ext = "text/csv; charset=utf-8", "csv"
+			err = res.writeCSV(&buf, query.Get("table"))
+		case "md", "markdown":
+			contentType, ext = "text/markdown; charset=utf-8", "md"
+			res.writeMarkdown(&buf)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("unknown format: " + format))
+
+			return
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(err.Error()))
+
+			return
+		}
+
+		l.Info("results exported", "room_id", roomID, "format", ext, "anonymized", res.Anonymized)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "results-"+room.RoomID+"."+ext))
+		w.Write(buf.Bytes())
+	}
+}
+
+func (res *Results) writeCSV(buf *bytes.Buffer, table string) error {
+	var records [][]string
+	switch table {
+	case "room":
+		records = [][]string{
+			{"key", "value"},
+			{"room_id", res.RoomID},
+			{"title", res.Title},
+			{"finished_at", res.FinishedAt.Format(time.RFC3339)},
+			{"rounds", strconv.Itoa(res.Rounds)},
+			{"players", strconv.Itoa(res.Players)},
+			{"anonymized", strconv.FormatBool(res.Anonymized)},
+		}
+	case "candidates":
+		records = [][]string{{"candidate_id", "order", "name", "score"}}
+		for _, c := range res.Candidates {
+			records = append(records, []string{c.ID, strconv.Itoa(c.Order), c.Name, strconv.Itoa(c.Score)})
+		}
+	case "", "tallies":
+		records = [][]string{{"round", "candidate_id", "candidate_name", "votes", "voters", "turnout"}}
+		for _, t := range res.Tallies {
+			for _, c := range res.Candidates {
+				records = append(records, []string{
+					strconv.Itoa(t.Round), c.ID, c.Name, strconv.Itoa(t.Votes[c.ID]),
+					strconv.Itoa(t.Voters), strconv.FormatFloat(t.Turnout, 'f', 4, 64),
+				})
+			}
+		}
+	case "ballots":
+		records = [][]string{{"round", "voter", "voter_name", "candidate_id", "candidate_name", "receipt"}}
+		for _, b := range res.Ballots {
+			records = append(records, []string{
+				strconv.Itoa(b.Round), b.Voter, b.VoterName, b.Candidate, res.candidateName(b.Candidate), b.Receipt,
+			})
+		}
+	default:
+		return fmt.Errorf("unknown table: %s", table)
+	}
+
+	return csv.NewWriter(buf).WriteAll(records)
+}
+
+// writeMarkdown writes a summary meant to be pasted into meeting notes.
+func (res *Results) writeMarkdown(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "# %s\n\n", markdownEscape(res.Title))
+	fmt.Fprintf(buf, "- Room: `%s`\n", res.RoomID)
+	fmt.Fprintf(buf, "- Finished: %s\n", res.FinishedAt.Format(time.RFC3339))
+	fmt.Fprintf(buf, "- Rounds: %d\n", res.Rounds)
+	fmt.Fprintf(buf, "- Players: %d\n\n", res.Players)
+
+	ranked := make([]*Candidate, len(res.Candidates))
+	copy(ranked, res.Candidates)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	buf.WriteString("## Results\n\n| # | Candidate | Score |\n|---|---|---|\n")
+	for i, c := range ranked {
+		fmt.Fprintf(buf, "| %d | %s | %d |\n", i+1, markdownEscape(c.Name), c.Score)
+	}
+
+	for _, t := range res.Tallies {
+		fmt.Fprintf(buf, "\n## Round %d\n\nTurnout: %d of %d (%.0f%%)\n\n| Candidate | Votes |\n|---|---|\n",
+			t.Round, t.Voters, res.Players, t.Turnout*100)
+		for _, c := range res.Candidates {
+			fmt.Fprintf(buf, "| %s | %d |\n", markdownEscape(c.Name), t.Votes[c.ID])
+		}
+	}
+
+	if len(res.Ballots) == 0 {
+		return
+	}
+
+	buf.WriteString("\n## Ballots\n\n| Round | Voter | Candidate |\n|---|---|---|\n")
+	for _, b := range res.Ballots {
+		voter := b.Voter
+		if len(b.VoterName) != 0 {
+			voter = b.VoterName + " (" + b.Voter + ")"
+		}
+
+		fmt.Fprintf(buf, "| %d | %s | %s |\n", b.Round, markdownEscape(voter), markdownEscape(res.candidateName(b.Candidate)))
+	}
+}
+
+var _markdownEscaper = strings.NewReplacer("|", "\\|", "\n", " ", "\r", " ", "*", "\\*", "_", "\\_", "`", "\\`", "[", "\\[", "]", "\\]", "<", "&lt;", ">", "&gt;")
+
+func markdownEscape(s string) string {
+	return _markdownEscaper.Replace(s)
+}
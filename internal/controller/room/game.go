@@ -0,0 +1,171 @@
+package room
+
+import "time"
+
+// GameSettings adds or renames the candidates of the room and changes its
+// settings. Candidates without an ID are added, the ones with an ID are renamed.
+// Countdown is the length of a round in seconds, zero values keep the current
+// settings.
+type GameSettings struct {
+	Candidates            []*Candidate `json:"candidates"`
+	Countdown             int64        `json:"countdown"`
+	DashboardDisplayLimit int          `json:"dashboard_display_limit"`
+}
+
+// RoundCommand starts the round after Round, or ends the game when GameOver is
+// set. Round is the current round as the sender knows it.
+type RoundCommand struct {
+	Round    int  `json:"round"`
+	Start    bool `json:"start"`
+	GameOver bool `json:"game_over"`
+}
+
+// SetGame applies the settings and sends the candidates to the players. It is
+// shared by the host websocket and the REST API. An unknown candidate ID fails
+// with ErrCandidateNotFound before anything is changed.
+func (r *Room) SetGame(settings *GameSettings) error {
+	if err := r.StoreCandidates(settings.Candidates); err != nil {
+		return err
+	}
+
+	if settings.DashboardDisplayLimit != 0 {
+		r.dashboardPlayerDisplayLimit.Store(settings.DashboardDisplayLimit)
+	}
+
+	if settings.Countdown != 0 {
+		r.countdown.Store(time.Duration(settings.Countdown) * time.Second)
+	}
+
+	cs := r.GetCandidates()
+	limit := r.dashboardPlayerDisplayLimit.Load()
+	ds, seq := r.GetDashboard(limit)
+
+	r.BroadcastPlayers(PlayerWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeConnect,
+		Connect: &PlayerWsMessageConnectResponse{
+			Candidates:     cs,
+			Dashboard:      ds,
+			DashboardLimit: limit,
+			Seq:            seq,
+			GameOver:       r.IsGameOver.Load(),
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	return nil
+}
+
+// PlayRound starts the next round or ends the game, then sends the round to the
+// host and players. It is shared by the host websocket and the REST API. A
+// stale round fails with ErrRoundMismatch and sends nothing.
+func (r *Room) PlayRound(cmd *RoundCommand) error {
+	var endTime int64
+
+	if r.Round.Load() > cmd.Round {
+		r.l.Warn("skip round", "saved", r.Round.Load(), "incoming", cmd.Round)
+		return ErrRoundMismatch
+	}
+
+	switch {
+	case cmd.GameOver:
+		alreadyGameOver := r.IsGameOver.Swap(true)
+		if alreadyGameOver {
+			r.l.Warn("skip round, already game over")
+			return ErrGameOver
+		}
+		r.advance(StateFinished)
+		r.auditTally()
+		r.BroadcastDashboardUpdate(true)
+		r.recordResults()
+		r.publishReceipts()
+		r.fireGameOver()
+	case r.IsGameOver.Load():
+		r.l.Warn("skip round, game over")
+		return ErrGameOver
+	case cmd.Start:
+		r.advance(StateRunning)
+		endTime = time.Now().Add(r.countdown.Load()).UnixMilli()
+		// HINT: the end time goes first, a vote of the new round never sees the
+		// end time of the previous one.
+		r.RoundEndTime.Store(endTime)
+		r.Round.Store(cmd.Round + 1)
+		r.startRound(cmd.Round+1, endTime)
+	default:
+		r.l.Warn("skip round, unknown")
+		return ErrBadRequest
+	}
+
+	r.broadcastRound(endTime)
+
+	return nil
+}
+
+// StopRound ends the running round before its countdown is over.
+func (r *Room) StopRound() error {
+	if r.IsGameOver.Load() {
+		return ErrGameOver
+	}
+
+	now := time.Now().UnixMilli()
+	if r.Round.Load() == 0 || r.RoundEndTime.Load() <= now {
+		return ErrNoRunningRound
+	}
+
+	r.RoundEndTime.Store(now)
+	r.endRound(r.Round.Load())
+	r.broadcastRound(now)
+
+	return nil
+}
+
+func (r *Room) broadcastRound(endTime int64) {
+	dashboard, seq := r.GetDashboard()
+	gameOver := r.IsGameOver.Load()
+	round := r.Round.Load()
+
+	r.sendHost(HostWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeRound,
+		Round: &HostWsMessageRoundResponse{
+			Round:    round,
+			GameOver: gameOver,
+			EndTime:  endTime,
+		},
+		Dashboard: &HostWsMessageDashboardResponse{
+			Dashboard: dashboard,
+			Seq:       seq,
+			GameOver:  gameOver,
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	// HINT: players see only the top of the dashboard, it's sorted already.
+	playerDashboard := dashboard
+	if limit := r.dashboardPlayerDisplayLimit.Load(); limit > 0 && limit < len(dashboard) {
+		playerDashboard = dashboard[:limit]
+	}
+
+	r.BroadcastPlayers(PlayerWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeRound,
+		Round: &PlayerWsMessageRoundResponse{
+			Dashboard: playerDashboard,
+			Seq:       seq,
+			Round:     round,
+			EndTime:   endTime,
+			GameOver:  gameOver,
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+// sendHost queues msg for the host. It never blocks, a room driven through the
+// REST API may have no host connected to drain the queue.
+func (r *Room) sendHost(msg HostWsMessageOutgoing) {
+	select {
+	case r.HostMsg <- msg:
+	default:
+		r.l.Debug("host queue full, drop message", "type", msg.Type)
+	}
+}
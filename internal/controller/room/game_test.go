@@ -0,0 +1,194 @@
+package room
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStopRoundRejectsVotes(t *testing.T) {
+	r := NewRoom("test-stop-round", "stop round")
+	defer r.Close()
+
+	r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}, {Name: "b"}}, Countdown: 60})
+	r.AddPlayer(NewPlayer("early", "early"))
+	r.AddPlayer(NewPlayer("late", "late"))
+	candidate := r.GetCandidates()[0].ID
+
+	if _, err := r.VoteCandidate("early", 0, candidate, ""); !errors.Is(err, ErrNoRunningRound) {
+		t.Fatalf("VoteCandidate() before the first round = %v, want %v", err, ErrNoRunningRound)
+	}
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.VoteCandidate("early", 1, candidate, ""); err != nil {
+		t.Fatalf("VoteCandidate() in the round = %v", err)
+	}
+
+	if err := r.StopRound(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.VoteCandidate("late", 1, candidate, ""); !errors.Is(err, ErrNoRunningRound) {
+		t.Fatalf("VoteCandidate() after StopRound = %v, want %v", err, ErrNoRunningRound)
+	}
+
+	dashboard, _ := r.GetDashboard()
+	total := 0
+	for _, c := range dashboard {
+		total += c.Score
+	}
+
+	if total != 1 {
+		t.Errorf("votes counted = %d, want 1", total)
+	}
+}
+
+func TestRoundHonorsDashboardLimit(t *testing.T) {
+	r := NewRoom("test-round-limit", "round limit")
+	defer r.Close()
+
+	player := NewPlayer("player", "player")
+	r.AddPlayer(player)
+	r.SetGame(&GameSettings{
+		Candidates:            []*Candidate{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}, {Name: "e"}},
+		Countdown:             60,
+		DashboardDisplayLimit: 4,
+	})
+	<-player.Channel
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := <-player.Channel
+	if msg.Round == nil {
+		t.Fatalf("player got %q, want %q", msg.Type, MessageTypeRound)
+	}
+
+	if got := len(msg.Round.Dashboard); got != 4 {
+		t.Errorf("round dashboard = %d candidates, want 4", got)
+	}
+}
+
+func TestGetCandidatesReturnsCopies(t *testing.T) {
+	r := NewRoom("test-candidates-copy", "candidates copy")
+	defer r.Close()
+
+	r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}}, Countdown: 60})
+	r.AddPlayer(NewPlayer("player", "player"))
+	candidates := r.GetCandidates()
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.VoteCandidate("player", 1, candidates[0].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if candidates[0].Score != 0 {
+		t.Errorf("candidate taken before the vote has score %d, want 0", candidates[0].Score)
+	}
+
+	if got := r.GetCandidates()[0].Score; got != 1 {
+		t.Errorf("candidate score = %d, want 1", got)
+	}
+}
+
+func TestSetGameUpdatesCandidates(t *testing.T) {
+	r := NewRoom("test-set-game", "set game")
+	defer r.Close()
+
+	if err := r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}, {Name: "b"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	candidates := r.GetCandidates()
+	err := r.SetGame(&GameSettings{Candidates: []*Candidate{{ID: candidates[1].ID, Name: "renamed"}, {Name: "c"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.GetCandidates()
+	if len(got) != 3 || got[0].Name != "a" || got[1].Name != "renamed" || got[2].Name != "c" || got[2].Order != 2 {
+		t.Fatalf("candidates = %+v, want a, renamed, c", got)
+	}
+
+	err = r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "d"}, {ID: "unknown", Name: "x"}}})
+	if !errors.Is(err, ErrCandidateNotFound) {
+		t.Fatalf("SetGame() of an unknown ID = %v, want %v", err, ErrCandidateNotFound)
+	}
+
+	if got := r.GetCandidates(); len(got) != 3 {
+		t.Errorf("candidates after a failed SetGame() = %d, want 3", len(got))
+	}
+}
+
+func TestPlayRoundMismatchSendsNothing(t *testing.T) {
+	r := NewRoom("test-round-mismatch", "round mismatch")
+	defer r.Close()
+
+	player := NewPlayer("player", "player")
+	r.AddPlayer(player)
+	r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}}, Countdown: 60})
+	<-player.Channel
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); err != nil {
+		t.Fatal(err)
+	}
+	<-player.Channel
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); !errors.Is(err, ErrRoundMismatch) {
+		t.Fatalf("PlayRound() of a stale round = %v, want %v", err, ErrRoundMismatch)
+	}
+
+	if len(player.Channel) != 0 {
+		t.Errorf("player got %q after a stale round", (<-player.Channel).Type)
+	}
+}
+
+func TestVoteCandidateConcurrentRetries(t *testing.T) {
+	r := NewRoom("test-vote-retries", "vote retries")
+	defer r.Close()
+
+	r.SetGame(&GameSettings{Candidates: []*Candidate{{Name: "a"}}, Countdown: 60})
+	r.AddPlayer(NewPlayer("player", "player"))
+	candidate := r.GetCandidates()[0].ID
+
+	if err := r.PlayRound(&RoundCommand{Round: 0, Start: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		counted atomic.Int64
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vote, err := r.VoteCandidate("player", 1, candidate, "vote-1")
+			if err != nil {
+				t.Errorf("VoteCandidate() retry = %v, want the duplicate ack", err)
+				return
+			}
+
+			if !vote.Duplicate {
+				counted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := counted.Load(); got != 1 {
+		t.Errorf("votes counted = %d, want 1", got)
+	}
+
+	if _, err := r.VoteCandidate("player", 1, candidate, "vote-2"); !errors.Is(err, ErrAlreadyVoted) {
+		t.Errorf("VoteCandidate() with another vote ID = %v, want %v", err, ErrAlreadyVoted)
+	}
+}
@@ -1,11 +1,11 @@
 package room
 
 import (
-	"log/slog"
 	"net/http"
 
-	"main/internal/keyword"
-	"main/internal/utils"
+	"main/internal/logger"
+	"main/internal/page"
+	"main/internal/session"
 
 	"github.com/google/uuid"
 	"github.com/spf13/viper"
@@ -13,25 +13,42 @@ import (
 
 func GetRoom() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
 		room, ok := _roomPool.Load(r.PathValue("room_id"))
 		if !ok {
-			slog.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
+			l.Warn("GetRoom, room id not found in pool", "room_id", r.PathValue("room_id"))
 			w.Write([]byte("room not found"))
 
 			return
 		}
 
+		if room.IsClosed() {
+			l.Warn("GetRoom, room closed", "room_id", room.RoomID)
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte("room closed"))
+
+			return
+		}
+
+		if room.RequireLogin {
+			if _, ok := session.Identity(r, room.RoomID); !ok {
+				http.Redirect(w, r, viper.GetString("host")+"/vote/"+room.RoomID+"/login", http.StatusSeeOther)
+				return
+			}
+		}
+
 		isRoomStarted := room.IsGameStart.Load()
 		if isRoomStarted {
-			slog.Warn("GetRoom, room is already started", "room_id", r.PathValue("room_id"))
+			l.Warn("GetRoom, room is already started", "room_id", r.PathValue("room_id"))
 		}
 
-		w.Write(utils.ReadFile("./internal/resource/room.html", map[string]string{
-			keyword.Host:        viper.GetString("host"),
-			keyword.UID:         uuid.NewString(),
-			keyword.RoomID:      room.RoomID,
-			keyword.RoomStarted: utils.BoolToString(isRoomStarted),
-			keyword.RoomTitle:   room.Title,
-		}))
+		page.Render(w, page.Room, page.RoomData{
+			Host:        viper.GetString("host"),
+			UID:         uuid.NewString(),
+			RoomID:      room.RoomID,
+			RoomStarted: isRoomStarted,
+			RoomLocked:  room.IsLocked(),
+			RoomTitle:   room.Title,
+		})
 	}
 }
@@ -3,14 +3,18 @@ package room
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"main/internal/logger"
+	"main/internal/metrics"
+	"main/internal/ratelimit"
+	"main/internal/session"
 	"main/internal/utils"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	"github.com/yanun0323/pkg/logs"
 )
 
 const (
@@ -26,38 +30,45 @@ const (
 
 	// Maximum message size allowed from peer.
 	_maxMessageSize = 512
+
+	// Maximum message size allowed from host, which sends the candidate list.
+	_maxHostMessageSize = 8192
 )
 
 type HostWsMessageIncoming struct {
-	Connect bool                          `json:"connect"`
-	SetGame *HostWsMessageSetGameIncoming `json:"set_game"`
-	Round   *HostWsMessageRoundIncoming   `json:"round"`
+	Version   int                           `json:"version"`
+	Type      MessageType                   `json:"type"`
+	RequestID string                        `json:"request_id"`
+	Connect   bool                          `json:"connect"`
+	SetGame   *HostWsMessageSetGameIncoming `json:"set_game"`
+	Round     *HostWsMessageRoundIncoming   `json:"round"`
 }
 
 type (
-	HostWsMessageSetGameIncoming struct {
-		Candidates            []*Candidate `json:"candidates"`
-		Countdown             int64        `json:"countdown"`
-		DashboardDisplayLimit int          `json:"dashboard_display_limit"`
-	}
-	HostWsMessageRoundIncoming struct {
-		Round    int  `json:"round"`
-		Start    bool `json:"start"`
-		GameOver bool `json:"game_over"`
-	}
+	HostWsMessageSetGameIncoming = GameSettings
+	HostWsMessageRoundIncoming   = RoundCommand
 )
 
 type HostWsMessageOutgoing struct {
-	Connect   *HostWsMessageConnectResponse   `json:"connect,omitempty"`
-	Round     *HostWsMessageRoundResponse     `json:"round,omitempty"`
-	Dashboard *HostWsMessageDashboardResponse `json:"dashboard,omitempty"`
-	Player    *HostWsMessagePlayerResponse    `json:"player,omitempty"`
-	Timestamp int64                           `json:"timestamp"`
+	Version        int                                  `json:"version"`
+	Type           MessageType                          `json:"type"`
+	RequestID      string                               `json:"request_id,omitempty"`
+	Ack            *Ack                                 `json:"ack,omitempty"`
+	Error          *Error                               `json:"error,omitempty"`
+	Connect        *HostWsMessageConnectResponse        `json:"connect,omitempty"`
+	Round          *HostWsMessageRoundResponse          `json:"round,omitempty"`
+	Dashboard      *HostWsMessageDashboardResponse      `json:"dashboard,omitempty"`
+	DashboardDelta *HostWsMessageDashboardDeltaResponse `json:"dashboard_delta,omitempty"`
+	Player         *HostWsMessagePlayerResponse         `json:"player,omitempty"`
+	Restart        *RestartNotice                       `json:"restart,omitempty"`
+	Receipts       []Receipt                            `json:"receipts,omitempty"`
+	Timestamp      int64                                `json:"timestamp"`
 }
 
 type (
 	HostWsMessageConnectResponse struct {
 		Dashboard []*Candidate `json:"dashboard"`
+		Seq       int64        `json:"seq"`
 		Player    []string     `json:"player"`
 		Round     int          `json:"round"`
 		EndTime   int64        `json:"end_time"`
@@ -72,18 +83,25 @@ type (
 
 	HostWsMessageDashboardResponse struct {
 		Dashboard []*Candidate `json:"dashboard"`
+		Seq       int64        `json:"seq"`
 		GameOver  bool         `json:"game_over"`
 	}
 
+	HostWsMessageDashboardDeltaResponse struct {
+		Candidates []*Candidate `json:"candidates"`
+		Seq        int64        `json:"seq"`
+		GameOver   bool         `json:"game_over"`
+	}
+
 	HostWsMessagePlayerResponse struct {
 		Player []string `json:"player"`
 	}
 )
 
-func ConnectHost() func(w http.ResponseWriter, r *http.Request) {
+func ConnectHost(messages *ratelimit.Policy) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		l := logs.New(logs.LevelDebug).WithField("host", r.RequestURI)
-		l.Info("wss request received")
+		l := logger.FromContext(r.Context())
+		l.Info("wss request received", "uri", r.RequestURI)
 		utils.SetWss(r)
 
 		roomID, uid := r.PathValue("room_id"), r.PathValue("uid")
@@ -94,7 +112,7 @@ func ConnectHost() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		l = logs.New(logs.LevelDebug).WithField("host", uid)
+		l = l.With("room_id", roomID, "host", uid)
 
 		if roomID != uid {
 			l.Warn("roomID and uid are not equal")
@@ -111,14 +129,38 @@ func ConnectHost() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if !session.VerifyHost(r, room.RoomID) {
+			l.Warn("host token is invalid")
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if room.IsClosed() {
+			l.Warn("room closed")
+			w.WriteHeader(http.StatusGone)
+
+			return
+		}
+
+		if IsDraining() {
+			l.Warn("server draining")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
 		conn, err := _upgrade.Upgrade(w, r, nil)
 		if err != nil {
-			l.Errorf("upgrade, err: %+v", err)
+			l.Error("upgrade", "error", err)
+			metrics.UpgradeFailures.WithLabelValues("host").Inc()
 			w.WriteHeader(http.StatusUnauthorized)
 
 			return
 		}
 
+		room.advance(StateOpen)
+
 		h := Host{
 			l:   l,
 			UID: uid,
@@ -126,7 +168,12 @@ func ConnectHost() func(w http.ResponseWriter, r *http.Request) {
 
 		ctx, cancel := context.WithCancel(context.Background())
 
-		go h.handleIncoming(cancel, conn, room)
+		client := "host:" + roomID
+		allow := func() bool { return messages.Allow(client, roomID) }
+
+		_connections.Add(1)
+		room.hostConns.Add(1)
+		go h.handleIncoming(cancel, conn, room, allow)
 		go h.handleOutgoing(ctx, conn, room)
 
 		h.l.Info("wss connected")
@@ -134,7 +181,7 @@ func ConnectHost() func(w http.ResponseWriter, r *http.Request) {
 }
 
 type Host struct {
-	l   logs.Logger
+	l   *slog.Logger
 	UID string
 }
 
@@ -143,18 +190,26 @@ func (h *Host) handleOutgoing(ctx context.Context, conn *websocket.Conn, room *R
 	defer func() {
 		ticker.Stop()
 		conn.Close()
+		room.hostConns.Add(-1)
+		_connections.Done()
 	}()
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-room.Done():
+			h.l.Info("room stopped, close connection")
+			room.closeHost(conn)
+			return
 		case <-room.PlayerUpdate:
-			room.HostMsg <- HostWsMessageOutgoing{
+			room.sendHost(HostWsMessageOutgoing{
+				Version: _protocolVersion,
+				Type:    MessageTypePlayer,
 				Player: &HostWsMessagePlayerResponse{
 					Player: room.GetPlayerNames(),
 				},
 				Timestamp: time.Now().UnixMilli(),
-			}
+			})
 		case msg, ok := <-room.HostMsg:
 			conn.SetWriteDeadline(time.Now().Add(_writeWait))
 			if !ok {
@@ -166,20 +221,20 @@ func (h *Host) handleOutgoing(ctx context.Context, conn *websocket.Conn, room *R
 
 			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
-				h.l.Errorf("NextWriter TextMessage, err: %+v", err)
+				h.l.Error("NextWriter TextMessage", "error", err)
 				return
 			}
 
 			data, err := json.Marshal(msg)
 			if err != nil {
-				h.l.Errorf("message.Marshal, err: %+v", err)
+				h.l.Error("message.Marshal", "error", err)
 				continue
 			} else {
 				w.Write(data)
 			}
 
 			if err := w.Close(); err != nil {
-				h.l.Errorf("w.Close, err: %+v", err)
+				h.l.Error("w.Close", "error", err)
 				return
 			}
 
@@ -187,29 +242,29 @@ func (h *Host) handleOutgoing(ctx context.Context, conn *websocket.Conn, room *R
 		case <-ticker.C:
 			conn.SetWriteDeadline(time.Now().Add(_writeWait))
 			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				h.l.Errorf("WriteMessage, err: %+v", err)
+				h.l.Error("WriteMessage", "error", err)
 				return
 			}
 		}
 	}
 }
 
-func (h *Host) handleIncoming(cancel context.CancelFunc, conn *websocket.Conn, room *Room) {
+func (h *Host) handleIncoming(cancel context.CancelFunc, conn *websocket.Conn, room *Room, allow func() bool) {
 	defer func() {
 		conn.Close()
 		cancel()
 	}()
-	conn.SetReadLimit(_maxMessageSize)
+	conn.SetReadLimit(_maxHostMessageSize)
 	conn.SetReadDeadline(time.Now().Add(_pongWait))
 	conn.SetPongHandler(func(string) error { conn.SetReadDeadline(time.Now().Add(_pongWait)); return nil })
 
 	for {
 		msgType, message, err := conn.ReadMessage()
-		h.l.Debug("message received: ", "type: ", msgType, ", message: ", string(message))
+		h.l.Debug("message received", "type", msgType, "message", string(message))
 
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				h.l.Errorf("websocket.IsUnexpectedCloseError, err: %+v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				h.l.Error("websocket.IsUnexpectedCloseError", "error", err)
 			}
 
 			break
@@ -219,10 +274,16 @@ func (h *Host) handleIncoming(cancel context.CancelFunc, conn *websocket.Conn, r
 			break
 		}
 
+		if !allow() {
+			room.sendHost(newHostReply("", "", ErrRateLimited))
+			continue
+		}
+
 		var msg HostWsMessageIncoming
 		if len(message) != 0 {
 			if err := json.Unmarshal(message, &msg); err != nil {
-				h.l.Errorf("json.Unmarshal, err: %+v", err)
+				h.l.Error("json.Unmarshal", "error", err)
+				room.sendHost(newHostReply("", "", ErrBadRequest))
 
 				continue
 			}
@@ -233,124 +294,96 @@ func (h *Host) handleIncoming(cancel context.CancelFunc, conn *websocket.Conn, r
 }
 
 func (h *Host) handleHostIncomingMessage(room *Room, msg HostWsMessageIncoming) {
+	if msg.Version > _protocolVersion {
+		room.sendHost(newHostReply(msg.RequestID, msg.Type, ErrUnsupportedVersion))
+		return
+	}
+
+	var connect, setGame, round MessageType
 	if msg.Connect {
-		h.handleConnect(room)
+		connect = MessageTypeConnect
 	}
 
 	if msg.SetGame != nil {
-		h.handleSetGame(room, msg.SetGame)
+		setGame = MessageTypeSetGame
 	}
 
 	if msg.Round != nil {
-		h.handleRound(room, msg.Round)
+		round = MessageTypeRound
+	}
+
+	for _, command := range incomingCommands(msg.Type, connect, setGame, round) {
+		err := h.handleCommand(room, command, msg)
+		if err != nil {
+			h.l.Warn("command rejected", "command", command, "message_id", msg.RequestID, "error", err)
+		}
+
+		room.sendHost(newHostReply(msg.RequestID, command, err))
+	}
+}
+
+func (h *Host) handleCommand(room *Room, command MessageType, msg HostWsMessageIncoming) error {
+	switch command {
+	case MessageTypeConnect:
+		h.handleConnect(room)
+		return nil
+	case MessageTypeSetGame:
+		if msg.SetGame == nil {
+			return ErrBadRequest
+		}
+
+		return h.handleSetGame(room, msg.SetGame)
+	case MessageTypeRound:
+		if msg.Round == nil {
+			return ErrBadRequest
+		}
+
+		return h.handleRound(room, msg.Round)
+	default:
+		return ErrUnknownType
 	}
 }
 
 func (h *Host) handleConnect(room *Room) {
 	h.l.Debug("handleConnect")
-	room.HostMsg <- HostWsMessageOutgoing{
+	dashboard, seq := room.GetDashboard()
+	room.sendHost(HostWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeConnect,
 		Connect: &HostWsMessageConnectResponse{
-			Dashboard: room.GetDashboard(),
+			Dashboard: dashboard,
+			Seq:       seq,
 			Player:    room.GetPlayerNames(),
 			Round:     room.Round.Load(),
 			EndTime:   room.RoundEndTime.Load(),
 			GameOver:  room.IsGameOver.Load(),
 		},
 		Timestamp: time.Now().UnixMilli(),
-	}
+	})
 }
 
-func (h *Host) handleSetGame(room *Room, msg *HostWsMessageSetGameIncoming) {
+func (h *Host) handleSetGame(room *Room, msg *HostWsMessageSetGameIncoming) error {
 	h.l.Debug("handleSetGame")
-	m := make(map[string]*Candidate, len(msg.Candidates))
-
-	order := 0
-	for _, candidate := range msg.Candidates {
-		if len(candidate.Name) == 0 {
-			continue
-		}
-
-		candidate.ID = uuid.NewString()
-		candidate.Order = order
-		m[candidate.ID] = candidate
-		order++
-	}
-
-	room.StoreCandidates(m)
-
-	if msg.DashboardDisplayLimit != 0 {
-		room.dashboardPlayerDisplayLimit.Store(msg.DashboardDisplayLimit)
-	}
-
-	if msg.Countdown != 0 {
-		room.countdown.Store(time.Duration(msg.Countdown) * time.Second)
-	}
-
-	cs := room.GetCandidates()
-	ds := room.GetDashboard()
-
-	room.BroadcastPlayers(PlayerWsMessageOutgoing{
-		Connect: &PlayerWsMessageConnectResponse{
-			Candidates: cs,
-			Dashboard:  ds,
-			GameOver:   room.IsGameOver.Load(),
-		},
-		Timestamp: time.Now().UnixMilli(),
-	})
+	return room.SetGame(msg)
 }
 
-func (h *Host) handleRound(room *Room, msg *HostWsMessageRoundIncoming) {
+func (h *Host) handleRound(room *Room, msg *HostWsMessageRoundIncoming) error {
 	h.l.Debug("handleRound")
 
-	var endTime int64
-	if room.Round.Load() > msg.Round {
-		h.l.Warnf("skip round, saved: %d, incoming: %d", room.Round.Load(), msg.Round)
-	} else {
-		switch {
-		case msg.GameOver:
-			alreadyGameOver := room.IsGameOver.Swap(true)
-			if alreadyGameOver {
-				h.l.Warn("skip round, already game over")
-				return
-			}
-			room.BroadcastDashboardUpdate(true)
-		case room.IsGameOver.Load():
-			h.l.Warn("skip round, game over")
-			return
-		case msg.Start:
-			endTime = time.Now().Add(room.countdown.Load()).UnixMilli()
-			room.Round.Store(msg.Round + 1)
-			room.RoundEndTime.Store(endTime)
-		default:
-			h.l.Warn("skip round, unknown")
-			return
-		}
-	}
-
-	dashboard := room.GetDashboard()
-	gameOver := room.IsGameOver.Load()
-	round := room.Round.Load()
-
-	room.HostMsg <- HostWsMessageOutgoing{
-		Round: &HostWsMessageRoundResponse{
-			Round:    round,
-			GameOver: gameOver,
-			EndTime:  endTime,
-		},
-		Dashboard: &HostWsMessageDashboardResponse{
-			Dashboard: dashboard,
-			GameOver:  gameOver,
-		},
-		Timestamp: time.Now().UnixMilli(),
+	err := room.PlayRound(msg)
+	if errors.Is(err, ErrRoundMismatch) {
+		// HINT: the host is out of sync, send it the current round so it can catch up.
+		room.sendHost(HostWsMessageOutgoing{
+			Version: _protocolVersion,
+			Type:    MessageTypeRound,
+			Round: &HostWsMessageRoundResponse{
+				Round:    room.Round.Load(),
+				GameOver: room.IsGameOver.Load(),
+				EndTime:  room.RoundEndTime.Load(),
+			},
+			Timestamp: time.Now().UnixMilli(),
+		})
 	}
 
-	room.BroadcastPlayers(PlayerWsMessageOutgoing{
-		Round: &PlayerWsMessageRoundResponse{
-			Dashboard: dashboard,
-			Round:     round,
-			EndTime:   endTime,
-			GameOver:  gameOver,
-		},
-		Timestamp: time.Now().UnixMilli(),
-	})
+	return err
 }
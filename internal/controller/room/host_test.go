@@ -0,0 +1,64 @@
+package room
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"main/internal/ratelimit"
+	"main/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectHostRequiresHostToken(t *testing.T) {
+	room, _, err := openRoom(&CreateRoomRequest{UID: "test-connect-host", RoomTitle: "connect host"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room.Delete()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/vote/{room_id}/{uid}/host", ConnectHost(ratelimit.NewPolicy("test_host", ratelimit.ScopePlayer, ratelimit.Limit{}, ratelimit.Limit{})))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/vote/test-connect-host/test-connect-host/host"
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "no token", want: http.StatusUnauthorized},
+		{name: "player session", token: session.Sign("test-connect-host", "test-connect-host", 0), want: http.StatusUnauthorized},
+		{name: "other room", token: session.HostToken("other-room"), want: http.StatusUnauthorized},
+		{name: "host token", token: session.HostToken("test-connect-host"), want: http.StatusSwitchingProtocols},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if len(tt.token) != 0 {
+				header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+			if conn != nil {
+				conn.Close()
+			}
+
+			if resp == nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("Dial() status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	if room.State() != StateOpen {
+		t.Errorf("State() after the host connected = %s, want %s", room.State(), StateOpen)
+	}
+}
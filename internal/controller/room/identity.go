@@ -0,0 +1,17 @@
+package room
+
+// BindSubject binds a subject verified by the identity provider to uid. A subject
+// is bound to only one player per room. Rooms auditing voters record the binding
+// in the audit log, it is never sent to the host or players.
+func (r *Room) BindSubject(uid, subject string) bool {
+	bound, loaded := r.subjects.LoadOrStore(subject, uid)
+	if loaded {
+		return bound == uid
+	}
+
+	if r.AuditVoters {
+		r.auditIdentity(uid, subject)
+	}
+
+	return true
+}
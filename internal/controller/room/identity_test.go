@@ -0,0 +1,67 @@
+package room
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"main/internal/audit"
+
+	"github.com/spf13/viper"
+)
+
+func TestBindSubjectAuditsVoters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	viper.Set("audit.path", path)
+	defer viper.Set("audit.path", "")
+
+	if err := audit.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	audited := NewRoom("test-audit-voters", "audit voters")
+	defer audited.Close()
+	audited.AuditVoters = true
+
+	plain := NewRoom("test-plain-voters", "plain voters")
+	defer plain.Close()
+
+	for _, r := range []*Room{audited, plain} {
+		if !r.BindSubject("alice", "sub-alice") || !r.BindSubject("alice", "sub-alice") {
+			t.Fatalf("BindSubject() of %s = false, want true", r.RoomID)
+		}
+
+		if r.BindSubject("bob", "sub-alice") {
+			t.Errorf("BindSubject() of a bound subject in %s = true, want false", r.RoomID)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var identities []audit.Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e audit.Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Kind == audit.KindIdentity {
+			identities = append(identities, e)
+		}
+	}
+
+	if len(identities) != 1 {
+		t.Fatalf("identities = %+v, want one of %s", identities, audited.RoomID)
+	}
+
+	if e := identities[0]; e.RoomID != audited.RoomID || e.Subject != "sub-alice" || e.Voter != audit.Pseudonym(audited.RoomID, "alice") {
+		t.Errorf("identity = %+v", e)
+	}
+}
@@ -0,0 +1,223 @@
+package room
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+// State is a stage of the room lifecycle. A room only moves forward:
+// created → open → running → finished → archived → deleted.
+type State string
+
+const (
+	// StateCreated is a room whose host has not connected yet.
+	StateCreated State = "created"
+	// StateOpen is a room whose host connected, players are joining.
+	StateOpen State = "open"
+	// StateRunning is a room with a started round.
+	StateRunning State = "running"
+	// StateFinished is a room whose game is over.
+	StateFinished State = "finished"
+	// StateArchived is a room whose sockets are closed and players are freed.
+	// Only the results are kept until it is deleted.
+	StateArchived State = "archived"
+	// StateDeleted is a room removed from the pool.
+	StateDeleted State = "deleted"
+)
+
+// _closeArchived is the websocket close code sent to the connections of an archived room.
+const _closeArchived = 4001
+
+var (
+	_defaultJanitorInterval = time.Minute
+	_defaultStateTTL        = map[State]time.Duration{
+		StateCreated:  time.Hour,
+		StateOpen:     12 * time.Hour,
+		StateRunning:  12 * time.Hour,
+		StateFinished: 2 * time.Hour,
+		StateArchived: 24 * time.Hour,
+	}
+	_stateOrder = map[State]int{
+		StateCreated:  0,
+		StateOpen:     1,
+		StateRunning:  2,
+		StateFinished: 3,
+		StateArchived: 4,
+		StateDeleted:  5,
+	}
+)
+
+type lifecycle struct {
+	State State
+	Since time.Time
+}
+
+// State returns the lifecycle state of the room.
+func (r *Room) State() State {
+	return r.lifecycle.Load().State
+}
+
+// IsClosed reports whether the room is archived or deleted, and accepts no more
+// players or connections.
+func (r *Room) IsClosed() bool {
+	return _stateOrder[r.State()] >= _stateOrder[StateArchived]
+}
+
+// advance moves the room to state. Moving to the current state again counts as
+// activity and restarts its TTL, moving backward is ignored.
+func (r *Room) advance(state State) bool {
+	advanced := false
+	r.lifecycle.Exec(func(l *lifecycle) {
+		if _stateOrder[state] < _stateOrder[l.State] {
+			return
+		}
+
+		if l.State != state {
+			r.l.Info("room state changed", "from", l.State, "to", state)
+		}
+
+		l.State = state
+		l.Since = time.Now()
+		advanced = true
+	})
+
+	return advanced
+}
+
+// Done is closed when the room is archived or the server is restarting.
+func (r *Room) Done() <-chan struct{} {
+	return r.ctx.Done()
+}
+
+// Archive closes the sockets of the room and frees its players. The dashboard is
+// kept as the results until the room is deleted.
+func (r *Room) Archive() {
+	if r.IsClosed() || !r.advance(StateArchived) {
+		return
+	}
+
+	r.stop(_reasonArchived)
+	r.auditTally()
+	r.hooks.Close()
+	for _, player := range r.playerTable.ValueSlice() {
+		player.closeSession(_reasonArchived.Code, _reasonArchived.Text)
+	}
+
+	r.playerTable.Exec(func(m map[string]*Player) { clear(m) })
+	r.inviteTokens.Exec(func(m map[string]string) { clear(m) })
+	r.subjects.Exec(func(m map[string]string) { clear(m) })
+}
+
+// Delete archives the room and removes it from the pool.
+func (r *Room) Delete() {
+	r.Archive()
+	r.advance(StateDeleted)
+	if current, ok := _roomPool.Load(r.RoomID); ok && current == r {
+		_roomPool.Delete(r.RoomID)
+	}
+}
+
+// closeHost sends the close frame of a stopped room to the host connection.
+func (r *Room) closeHost(conn *websocket.Conn) {
+	reason := _reasonArchived
+	if cause, ok := context.Cause(r.ctx).(*closeReason); ok {
+		reason = cause
+	}
+
+	conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(reason.Code, reason.Text),
+		time.Now().Add(_writeWait),
+	)
+}
+
+// RoomCounts returns the number of rooms in the pool by state.
+func RoomCounts() map[State]int {
+	counts := map[State]int{}
+	for _, room := range _roomPool.ValueSlice() {
+		counts[room.State()]++
+	}
+
+	return counts
+}
+
+// LiveRooms returns the number of rooms which are not archived yet.
+func LiveRooms() int {
+	live := 0
+	for _, room := range _roomPool.ValueSlice() {
+		if !room.IsClosed() {
+			live++
+		}
+	}
+
+	return live
+}
+
+// RunJanitor archives and deletes the rooms outliving the TTL of their state
+// until ctx is done. TTLs are read from room.ttl.<state>, 0 keeps rooms in the
+// state forever.
+func RunJanitor(ctx context.Context) {
+	interval := viper.GetDuration("room.janitor_interval")
+	if interval <= 0 {
+		interval = _defaultJanitorInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweepRooms(now)
+		}
+	}
+}
+
+func sweepRooms(now time.Time) {
+	archived, deleted := 0, 0
+	for _, room := range _roomPool.ValueSlice() {
+		l := room.lifecycle.Load()
+		ttl := stateTTL(l.State)
+		if ttl <= 0 || now.Sub(l.Since) < ttl {
+			continue
+		}
+
+		if l.State == StateArchived {
+			room.Delete()
+			deleted++
+		} else {
+			room.Archive()
+			archived++
+		}
+	}
+
+	if archived == 0 && deleted == 0 {
+		return
+	}
+
+	counts := RoomCounts()
+	slog.Info("room janitor",
+		"live", LiveRooms(),
+		"archived", archived,
+		"deleted", deleted,
+		"created", counts[StateCreated],
+		"open", counts[StateOpen],
+		"running", counts[StateRunning],
+		"finished", counts[StateFinished],
+	)
+}
+
+func stateTTL(state State) time.Duration {
+	key := "room.ttl." + string(state)
+	if viper.IsSet(key) {
+		return viper.GetDuration(key)
+	}
+
+	return _defaultStateTTL[state]
+}
@@ -0,0 +1,148 @@
+package room
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"main/internal/logger"
+	"main/internal/oidc"
+	"main/internal/session"
+	"main/internal/utils"
+
+	"github.com/spf13/viper"
+)
+
+const _loginStateTTL = 10 * time.Minute
+
+type loginState struct {
+	RoomID string
+	Nonce  string
+	Expiry time.Time
+}
+
+var _loginStates = utils.NewSyncMap[string, loginState]()
+
+// Login redirects the player to the identity provider of a login-required room.
+func Login() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		room, ok := _roomPool.Load(r.PathValue("room_id"))
+		if !ok {
+			l.Warn("Login, room id not found in pool", "room_id", r.PathValue("room_id"))
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("room not found"))
+
+			return
+		}
+
+		if !room.RequireLogin {
+			http.Redirect(w, r, viper.GetString("host")+"/vote/"+room.RoomID, http.StatusSeeOther)
+			return
+		}
+
+		provider, err := oidc.Default()
+		if err != nil {
+			l.Error("oidc.Default", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		state, nonce := randomString(), randomString()
+		sweepLoginStates()
+		_loginStates.Store(state, loginState{
+			RoomID: room.RoomID,
+			Nonce:  nonce,
+			Expiry: time.Now().Add(_loginStateTTL),
+		})
+		session.IssueLoginState(w, state, _loginStateTTL)
+
+		url, err := provider.AuthCodeURL(r.Context(), state, nonce)
+		if err != nil {
+			l.Error("provider.AuthCodeURL", "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+}
+
+// LoginCallback verifies the login of the identity provider and issues the identity cookie.
+func LoginCallback() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		// HINT: the state must be the one of this browser, or a login started by
+		// someone else could be completed here.
+		if !session.VerifyLoginState(r, r.URL.Query().Get("state")) {
+			l.Warn("LoginCallback, state does not match the login state cookie")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("login expired, please try again"))
+
+			return
+		}
+
+		state, ok := _loginStates.Load(r.URL.Query().Get("state"))
+		if !ok || time.Now().After(state.Expiry) {
+			l.Warn("LoginCallback, state not found or expired")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("login expired, please try again"))
+
+			return
+		}
+
+		_loginStates.Delete(r.URL.Query().Get("state"))
+		session.ClearLoginState(w)
+
+		if e := r.URL.Query().Get("error"); len(e) != 0 {
+			l.Warn("LoginCallback, provider returned error", "error", e)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("login failed"))
+
+			return
+		}
+
+		provider, err := oidc.Default()
+		if err != nil {
+			l.Error("oidc.Default", "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, err := provider.Exchange(r.Context(), r.URL.Query().Get("code"), state.Nonce)
+		if err != nil {
+			l.Warn("LoginCallback, provider.Exchange", "error", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte("login failed"))
+
+			return
+		}
+
+		session.IssueIdentity(w, state.RoomID, claims.Subject)
+		http.Redirect(w, r, viper.GetString("host")+"/vote/"+state.RoomID, http.StatusSeeOther)
+	}
+}
+
+func sweepLoginStates() {
+	now := time.Now()
+	_loginStates.Exec(func(m map[string]loginState) {
+		for k, v := range m {
+			if now.After(v.Expiry) {
+				delete(m, k)
+			}
+		}
+	})
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,41 @@
+package room
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoginCallbackState(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+		want   int
+	}{
+		{name: "no cookie", state: "known", want: http.StatusBadRequest},
+		{name: "other browser", cookie: "other", state: "known", want: http.StatusBadRequest},
+		{name: "unknown state", cookie: "unknown", state: "unknown", want: http.StatusBadRequest},
+		// HINT: the provider error is checked once the state matched.
+		{name: "same browser", cookie: "known", state: "known", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_loginStates.Store("known", loginState{RoomID: "room", Nonce: "nonce", Expiry: time.Now().Add(time.Minute)})
+			defer _loginStates.Delete("known")
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/callback?error=access_denied&state="+tt.state, nil)
+			if len(tt.cookie) != 0 {
+				r.AddCookie(&http.Cookie{Name: "vote_login_state", Value: tt.cookie})
+			}
+
+			w := httptest.NewRecorder()
+			LoginCallback()(w, r)
+			if w.Code != tt.want {
+				t.Errorf("LoginCallback() status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
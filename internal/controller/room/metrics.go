@@ -0,0 +1,110 @@
+package room
+
+import (
+	"errors"
+
+	"main/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	_descRooms = prometheus.NewDesc("vote_rooms", "Rooms in the pool, by lifecycle state.", []string{"state"}, nil)
+	_descLive  = prometheus.NewDesc("vote_rooms_live", "Rooms which are not archived yet.", nil, nil)
+
+	_descHosts            = prometheus.NewDesc("vote_room_hosts_connected", "Connected host websockets of a room.", []string{"room_id"}, nil)
+	_descPlayers          = prometheus.NewDesc("vote_room_players", "Players joined to a room.", []string{"room_id"}, nil)
+	_descPlayersConnected = prometheus.NewDesc("vote_room_players_connected", "Connected players of a room.", []string{"room_id"}, nil)
+	_descHostQueue        = prometheus.NewDesc("vote_room_host_queue_depth", "Messages queued in Room.HostMsg.", []string{"room_id"}, nil)
+	_descPlayerQueue      = prometheus.NewDesc("vote_room_player_queue_depth", "Messages queued in Player.Channel, summed over the players of a room.", []string{"room_id"}, nil)
+	_descPlayerQueueMax   = prometheus.NewDesc("vote_room_player_queue_depth_max", "The deepest Player.Channel of a room.", []string{"room_id"}, nil)
+	_descPlayerDropped    = prometheus.NewDesc("vote_room_player_messages_dropped_total", "Broadcasts dropped for players whose queue was full.", []string{"room_id"}, nil)
+
+	_descDashboardUpdates    = prometheus.NewDesc("vote_room_dashboard_updates_total", "Dashboard changes queued for broadcasting.", []string{"room_id"}, nil)
+	_descDashboardBroadcasts = prometheus.NewDesc("vote_room_dashboard_broadcasts_total", "Dashboard delta messages broadcast.", []string{"room_id"}, nil)
+	_descDashboardCoalesced  = prometheus.NewDesc("vote_room_dashboard_coalesced_total", "Dashboard changes merged into the delta of another change.", []string{"room_id"}, nil)
+)
+
+type collector struct{}
+
+// NewCollector returns the collector of the room and connection gauges, read
+// from the room pool on every scrape.
+func NewCollector() prometheus.Collector {
+	return collector{}
+}
+
+func (collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- _descRooms
+	ch <- _descLive
+	ch <- _descHosts
+	ch <- _descPlayers
+	ch <- _descPlayersConnected
+	ch <- _descHostQueue
+	ch <- _descPlayerQueue
+	ch <- _descPlayerQueueMax
+	ch <- _descPlayerDropped
+	ch <- _descDashboardUpdates
+	ch <- _descDashboardBroadcasts
+	ch <- _descDashboardCoalesced
+}
+
+func (collector) Collect(ch chan<- prometheus.Metric) {
+	counts := RoomCounts()
+	for _, state := range []State{StateCreated, StateOpen, StateRunning, StateFinished, StateArchived} {
+		ch <- prometheus.MustNewConstMetric(_descRooms, prometheus.GaugeValue, float64(counts[state]), string(state))
+	}
+
+	ch <- prometheus.MustNewConstMetric(_descLive, prometheus.GaugeValue, float64(LiveRooms()))
+
+	for _, room := range _roomPool.ValueSlice() {
+		if room.IsClosed() {
+			continue
+		}
+
+		var connected, queued, deepest int
+		players := room.playerTable.ValueSlice()
+		for _, player := range players {
+			if player.Online.Load() {
+				connected++
+			}
+
+			depth := len(player.Channel)
+			queued += depth
+			deepest = max(deepest, depth)
+		}
+
+		ch <- prometheus.MustNewConstMetric(_descHosts, prometheus.GaugeValue, float64(room.hostConns.Load()), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descPlayers, prometheus.GaugeValue, float64(len(players)), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descPlayersConnected, prometheus.GaugeValue, float64(connected), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descHostQueue, prometheus.GaugeValue, float64(len(room.HostMsg)), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descPlayerQueue, prometheus.GaugeValue, float64(queued), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descPlayerQueueMax, prometheus.GaugeValue, float64(deepest), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descPlayerDropped, prometheus.CounterValue, float64(room.droppedMessages.Load()), room.RoomID)
+
+		stats := room.BroadcastStats()
+		ch <- prometheus.MustNewConstMetric(_descDashboardUpdates, prometheus.CounterValue, float64(stats.Updates), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descDashboardBroadcasts, prometheus.CounterValue, float64(stats.Broadcasts), room.RoomID)
+		ch <- prometheus.MustNewConstMetric(_descDashboardCoalesced, prometheus.CounterValue, float64(stats.Coalesced), room.RoomID)
+	}
+}
+
+// observeVote counts the result of VoteCandidate.
+func observeVote(vote *Vote, err error) {
+	if err != nil {
+		reason := string(ErrorCodeInternal)
+		var e *Error
+		if errors.As(err, &e) {
+			reason = string(e.Code)
+		}
+
+		metrics.VotesRejected.WithLabelValues(reason).Inc()
+		return
+	}
+
+	if vote.Duplicate {
+		metrics.VotesRejected.WithLabelValues("duplicate").Inc()
+		return
+	}
+
+	metrics.VotesAccepted.Inc()
+}
@@ -3,19 +3,23 @@ package room
 import (
 	"context"
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"time"
 
+	"main/internal/logger"
+	"main/internal/metrics"
+	"main/internal/ratelimit"
+	"main/internal/session"
 	"main/internal/utils"
 
 	"github.com/gorilla/websocket"
-	"github.com/yanun0323/pkg/logs"
 )
 
 var _upgrade = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
+	CheckOrigin:     utils.CheckOrigin,
 }
 
 type Candidate struct {
@@ -26,55 +30,118 @@ type Candidate struct {
 }
 
 type Player struct {
-	l         logs.Logger
-	UID       string
-	Name      string
-	Online    *utils.SyncValue[bool]
-	Channel   chan PlayerWsMessageOutgoing
-	VoteTable *utils.SyncMap[int, string]
+	l           *slog.Logger
+	UID         string
+	Name        string
+	Online      *utils.SyncValue[bool]
+	Channel     chan PlayerWsMessageOutgoing
+	VoteTable   *utils.SyncMap[int, Ballot]
+	session     *utils.SyncValue[*playerSession]
+	resumeToken *utils.SyncValue[string]
 }
 
 func NewPlayer(uid string, name string) *Player {
 	return &Player{
-		l:         logs.New(logs.LevelDebug).WithField("player", uid),
-		UID:       uid,
-		Name:      name,
-		Online:    utils.NewSyncValue(false),
-		Channel:   make(chan PlayerWsMessageOutgoing, _defaultChannelSize),
-		VoteTable: utils.NewSyncMap[int, string](),
+		l:           slog.Default().With("player", uid),
+		UID:         uid,
+		Name:        name,
+		Online:      utils.NewSyncValue(false),
+		Channel:     make(chan PlayerWsMessageOutgoing, _defaultChannelSize),
+		VoteTable:   utils.NewSyncMap[int, Ballot](),
+		session:     utils.NewSyncValue[*playerSession](nil),
+		resumeToken: utils.NewSyncValue(""),
+	}
+}
+
+// send queues msg for the player without blocking, and reports whether it was
+// queued.
+// ballotOf returns the ballot sent with voteID and its round.
+func (p *Player) ballotOf(voteID string) (int, Ballot, bool) {
+	var (
+		round  int
+		ballot Ballot
+		found  bool
+	)
+
+	p.VoteTable.Exec(func(m map[int]Ballot) {
+		for r, b := range m {
+			if b.VoteID == voteID {
+				round, ballot, found = r, b, true
+				return
+			}
+		}
+	})
+
+	return round, ballot, found
+}
+
+func (p *Player) send(msg PlayerWsMessageOutgoing) bool {
+	select {
+	case p.Channel <- msg:
+		return true
+	default:
+		p.l.Debug("player queue full, drop message", "type", msg.Type)
+		return false
 	}
 }
 
 type PlayerWsMessageIncoming struct {
-	Connect bool                         `json:"connect"`
-	Vote    *PlayerWsMessageVoteIncoming `json:"vote"`
+	Version   int                            `json:"version"`
+	Type      MessageType                    `json:"type"`
+	RequestID string                         `json:"request_id"`
+	Connect   bool                           `json:"connect"`
+	Vote      *PlayerWsMessageVoteIncoming   `json:"vote"`
+	Resume    *PlayerWsMessageResumeIncoming `json:"resume"`
 }
 
 type PlayerWsMessageVoteIncoming struct {
+	VoteID    string `json:"vote_id"`
 	Round     int    `json:"round"`
 	Candidate string `json:"candidate"`
 }
 
+// PlayerWsMessageResumeIncoming resumes a dropped connection, reporting the last
+// round and dashboard sequence number the client saw.
+type PlayerWsMessageResumeIncoming struct {
+	Token string `json:"token"`
+	Round int    `json:"round"`
+	Seq   int64  `json:"seq"`
+}
+
 type PlayerWsMessageOutgoing struct {
-	Connect   *PlayerWsMessageConnectResponse   `json:"connect,omitempty"`
-	Round     *PlayerWsMessageRoundResponse     `json:"round,omitempty"`
-	Dashboard *PlayerWsMessageDashboardResponse `json:"dashboard,omitempty"`
-	Timestamp int64                             `json:"timestamp"`
+	Version        int                                    `json:"version"`
+	Type           MessageType                            `json:"type"`
+	RequestID      string                                 `json:"request_id,omitempty"`
+	Ack            *Ack                                   `json:"ack,omitempty"`
+	Error          *Error                                 `json:"error,omitempty"`
+	Connect        *PlayerWsMessageConnectResponse        `json:"connect,omitempty"`
+	Round          *PlayerWsMessageRoundResponse          `json:"round,omitempty"`
+	Dashboard      *PlayerWsMessageDashboardResponse      `json:"dashboard,omitempty"`
+	DashboardDelta *PlayerWsMessageDashboardDeltaResponse `json:"dashboard_delta,omitempty"`
+	Resume         *PlayerWsMessageResumeResponse         `json:"resume,omitempty"`
+	Restart        *RestartNotice                         `json:"restart,omitempty"`
+	Receipts       []Receipt                              `json:"receipts,omitempty"`
+	Timestamp      int64                                  `json:"timestamp"`
 }
 
 type (
 	PlayerWsMessageConnectResponse struct {
-		Candidates []*Candidate `json:"candidates"`
-		Dashboard  []*Candidate `json:"dashboard"`
-		Round      int          `json:"round"`
-		RoundVoted string       `json:"round_voted"`
-		EndTime    int64        `json:"end_time"`
-		GameOver   bool         `json:"game_over"`
-		PlayerName string       `json:"player_name"`
+		Candidates     []*Candidate `json:"candidates"`
+		Dashboard      []*Candidate `json:"dashboard"`
+		DashboardLimit int          `json:"dashboard_limit"`
+		Seq            int64        `json:"seq"`
+		Round          int          `json:"round"`
+		RoundVoted     string       `json:"round_voted"`
+		RoundReceipt   string       `json:"round_receipt,omitempty"`
+		EndTime        int64        `json:"end_time"`
+		GameOver       bool         `json:"game_over"`
+		PlayerName     string       `json:"player_name"`
+		ResumeToken    string       `json:"resume_token"`
 	}
 
 	PlayerWsMessageRoundResponse struct {
 		Dashboard []*Candidate `json:"dashboard"`
+		Seq       int64        `json:"seq"`
 		Round     int          `json:"round"`
 		EndTime   int64        `json:"end_time"`
 		GameOver  bool         `json:"game_over"`
@@ -82,14 +149,35 @@ type (
 
 	PlayerWsMessageDashboardResponse struct {
 		Dashboard []*Candidate `json:"dashboard"`
+		Seq       int64        `json:"seq"`
 		GameOver  bool         `json:"game_over"`
 	}
+
+	PlayerWsMessageDashboardDeltaResponse struct {
+		Candidates []*Candidate `json:"candidates"`
+		Seq        int64        `json:"seq"`
+		GameOver   bool         `json:"game_over"`
+	}
+
+	// PlayerWsMessageResumeResponse carries the candidates and dashboard only
+	// when they changed since the state reported by the client.
+	PlayerWsMessageResumeResponse struct {
+		Candidates   []*Candidate `json:"candidates,omitempty"`
+		Dashboard    []*Candidate `json:"dashboard,omitempty"`
+		Seq          int64        `json:"seq"`
+		Round        int          `json:"round"`
+		RoundVoted   string       `json:"round_voted"`
+		RoundReceipt string       `json:"round_receipt,omitempty"`
+		EndTime      int64        `json:"end_time"`
+		GameOver     bool         `json:"game_over"`
+		ResumeToken  string       `json:"resume_token"`
+	}
 )
 
-func ConnectPlayer() func(w http.ResponseWriter, r *http.Request) {
+func ConnectPlayer(messages *ratelimit.Policy) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		l := logs.New(logs.LevelDebug).WithField("player", r.RequestURI)
-		l.Info("wss request received")
+		l := logger.FromContext(r.Context())
+		l.Info("wss request received", "uri", r.RequestURI)
 		utils.SetWss(r)
 
 		roomID, uid := r.PathValue("room_id"), r.PathValue("uid")
@@ -100,7 +188,7 @@ func ConnectPlayer() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		l = logs.New(logs.LevelDebug).WithField("player", uid)
+		l = l.With("room_id", roomID, "player", uid)
 
 		room, ok := _roomPool.Load(roomID)
 		if !ok {
@@ -110,9 +198,18 @@ func ConnectPlayer() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		conn, err := _upgrade.Upgrade(w, r, nil)
-		if err != nil {
-			l.Errorf("upgrade, err: %+v", err)
+		if room.IsClosed() {
+			l.Warn("room closed")
+			w.WriteHeader(http.StatusGone)
+
+			return
+		}
+
+		if IsDraining() {
+			l.Warn("server draining")
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
 		}
 
 		player, ok := room.GetPlayer(uid)
@@ -123,39 +220,51 @@ func ConnectPlayer() func(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		player.Online.Store(true)
-		room.PlayerUpdate <- struct{}{}
+		if !session.Verify(r, roomID, uid) {
+			l.Warn("session invalid")
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		conn, err := _upgrade.Upgrade(w, r, nil)
+		if err != nil {
+			l.Error("upgrade", "error", err)
+			metrics.UpgradeFailures.WithLabelValues("player").Inc()
+
+			return
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
+		session := &playerSession{conn: conn, cancel: cancel, l: l}
+		player.attachSession(session)
+
+		player.Online.Store(true)
+		room.NotifyPlayerUpdate()
+
+		client := "player:" + roomID + "/" + uid
+		allow := func() bool { return messages.Allow(client, roomID) }
 
-		go player.handlePlayerIncoming(cancel, conn, room)
-		go player.handlePlayerOutgoing(ctx, conn)
-		player.l.Info("wss connected")
+		_connections.Add(1)
+		go player.handlePlayerIncoming(session, room, allow)
+		go player.handlePlayerOutgoing(ctx, session)
+		l.Info("wss connected")
 	}
 }
 
-func (p *Player) handlePlayerOutgoing(ctx context.Context, conn *websocket.Conn) {
+func (p *Player) handlePlayerOutgoing(ctx context.Context, session *playerSession) {
+	conn, l := session.conn, session.l
 	ticker := time.NewTicker(_pingPeriod)
 	defer func() {
 		ticker.Stop()
 		conn.Close()
+		_connections.Done()
 	}()
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case msg, ok := <-p.Channel:
-			if msg.Connect != nil && len(msg.Connect.Dashboard) > 3 {
-				msg.Connect.Dashboard = msg.Connect.Dashboard[:3]
-			}
-
-			if msg.Round != nil && len(msg.Round.Dashboard) > 3 {
-				msg.Round.Dashboard = msg.Round.Dashboard[:3]
-			}
-
-			if msg.Dashboard != nil && len(msg.Dashboard.Dashboard) > 3 {
-				msg.Dashboard.Dashboard = msg.Dashboard.Dashboard[:3]
-			}
-
 			conn.SetWriteDeadline(time.Now().Add(_writeWait))
 			if !ok {
 				// The hub closed the channel.
@@ -165,38 +274,41 @@ func (p *Player) handlePlayerOutgoing(ctx context.Context, conn *websocket.Conn)
 
 			w, err := conn.NextWriter(websocket.TextMessage)
 			if err != nil {
-				p.l.Errorf("NextWriter, err: %+v", err)
+				l.Error("NextWriter", "error", err)
 				return
 			}
 
 			data, err := json.Marshal(msg)
 			if err != nil {
-				p.l.Errorf("message.Marshal, err: %+v", err)
+				l.Error("message.Marshal", "error", err)
 				continue
 			} else {
 				w.Write(data)
 			}
 
 			if err := w.Close(); err != nil {
-				p.l.Errorf("w.Close, err: %+v", err)
+				l.Error("w.Close", "error", err)
 				return
 			}
 		case <-ticker.C:
 			conn.SetWriteDeadline(time.Now().Add(_writeWait))
 			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				p.l.Errorf("WriteMessage, err: %+v", err)
+				l.Error("WriteMessage", "error", err)
 				return
 			}
 		}
 	}
 }
 
-func (p *Player) handlePlayerIncoming(cancel context.CancelFunc, conn *websocket.Conn, room *Room) {
+func (p *Player) handlePlayerIncoming(session *playerSession, room *Room, allow func() bool) {
+	conn, l := session.conn, session.l
 	defer func() {
 		conn.Close()
-		cancel()
-		p.Online.Store(false)
-		room.PlayerUpdate <- struct{}{}
+		session.cancel()
+		if p.detachSession(session) {
+			p.Online.Store(false)
+			room.NotifyPlayerUpdate()
+		}
 	}()
 	conn.SetReadLimit(_maxMessageSize)
 	conn.SetReadDeadline(time.Now().Add(_pongWait))
@@ -204,62 +316,123 @@ func (p *Player) handlePlayerIncoming(cancel context.CancelFunc, conn *websocket
 
 	for {
 		msgType, message, err := conn.ReadMessage()
-		p.l.Debug("message received: ", string(message))
+		l.Debug("message received", "message", string(message))
 
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				p.l.Errorf("websocket.IsUnexpectedCloseError, err: %+v", err)
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				l.Error("websocket.IsUnexpectedCloseError", "error", err)
 			}
 
 			break
 		}
 
 		if msgType == -1 {
-			p.l.Warn("disconnected")
+			l.Warn("disconnected")
 			break
 		}
 
+		if !allow() {
+			p.send(newPlayerReply("", "", nil, ErrRateLimited))
+			continue
+		}
+
 		var msg PlayerWsMessageIncoming
 		if len(message) != 0 {
 			if err := json.Unmarshal(message, &msg); err != nil {
-				p.l.Errorf("json.Unmarshal, err: %+v", err)
+				l.Error("json.Unmarshal", "error", err)
+				p.send(newPlayerReply("", "", nil, ErrBadRequest))
 
 				continue
 			}
 		}
 
-		p.handlePlayerIncomingMessage(room, msg)
+		p.handlePlayerIncomingMessage(l, room, msg)
 
 	}
 }
 
-func (p *Player) handlePlayerIncomingMessage(room *Room, msg PlayerWsMessageIncoming) {
+func (p *Player) handlePlayerIncomingMessage(l *slog.Logger, room *Room, msg PlayerWsMessageIncoming) {
+	if msg.Version > _protocolVersion {
+		p.send(newPlayerReply(msg.RequestID, msg.Type, nil, ErrUnsupportedVersion))
+		return
+	}
+
+	var connect, vote, resume MessageType
 	if msg.Connect {
-		p.handlePlayerConnect(room)
+		connect = MessageTypeConnect
 	}
 
 	if msg.Vote != nil {
-		p.handlePlayerVote(room, msg.Vote)
+		vote = MessageTypeVote
+	}
+
+	if msg.Resume != nil {
+		resume = MessageTypeResume
+	}
+
+	for _, command := range incomingCommands(msg.Type, connect, resume, vote) {
+		ack, err := p.handlePlayerCommand(room, command, msg)
+		if err != nil {
+			l.Warn("command rejected", "command", command, "message_id", msg.RequestID, "error", err)
+		}
+
+		p.send(newPlayerReply(msg.RequestID, command, ack, err))
+	}
+}
+
+func (p *Player) handlePlayerCommand(room *Room, command MessageType, msg PlayerWsMessageIncoming) (*Ack, error) {
+	switch command {
+	case MessageTypeConnect:
+		p.handlePlayerConnect(room)
+		return nil, nil
+	case MessageTypeVote:
+		if msg.Vote == nil {
+			return nil, ErrBadRequest
+		}
+
+		vote, err := p.handlePlayerVote(room, msg.Vote)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Ack{Vote: vote}, nil
+	case MessageTypeResume:
+		if msg.Resume == nil {
+			return nil, ErrBadRequest
+		}
+
+		return nil, p.handlePlayerResume(room, msg.Resume)
+	default:
+		return nil, ErrUnknownType
 	}
 }
 
 func (p *Player) handlePlayerConnect(room *Room) {
 	round := room.Round.Load()
 	voted, _ := p.VoteTable.Load(round)
-	p.Channel <- PlayerWsMessageOutgoing{
+	limit := room.dashboardPlayerDisplayLimit.Load()
+	dashboard, seq := room.GetDashboard(limit)
+	p.send(PlayerWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeConnect,
 		Connect: &PlayerWsMessageConnectResponse{
-			Candidates: room.GetCandidates(),
-			Dashboard:  room.GetDashboard(),
-			Round:      round,
-			RoundVoted: voted,
-			EndTime:    room.RoundEndTime.Load(),
-			GameOver:   room.IsGameOver.Load(),
-			PlayerName: p.Name,
+			Candidates:     room.GetCandidates(),
+			Dashboard:      dashboard,
+			DashboardLimit: limit,
+			Seq:            seq,
+			Round:          round,
+			RoundVoted:     voted.Candidate,
+			RoundReceipt:   voted.Receipt,
+			EndTime:        room.RoundEndTime.Load(),
+			GameOver:       room.IsGameOver.Load(),
+			PlayerName:     p.Name,
+			ResumeToken:    p.issueResumeToken(),
 		},
 		Timestamp: time.Now().UnixMilli(),
-	}
+	})
+	p.sendReceipts(room)
 }
 
-func (p *Player) handlePlayerVote(room *Room, msg *PlayerWsMessageVoteIncoming) {
-	room.VoteCandidate(p.UID, msg.Round, msg.Candidate)
+func (p *Player) handlePlayerVote(room *Room, msg *PlayerWsMessageVoteIncoming) (*Vote, error) {
+	return room.VoteCandidate(p.UID, msg.Round, msg.Candidate, msg.VoteID)
 }
@@ -0,0 +1,172 @@
+package room
+
+import (
+	"errors"
+	"time"
+)
+
+// _protocolVersion is the websocket protocol version spoken by the server.
+// Messages without a version are handled as legacy version 0 messages, where
+// the command is inferred from the populated fields.
+const _protocolVersion = 1
+
+type MessageType string
+
+const (
+	MessageTypeConnect        MessageType = "connect"
+	MessageTypeSetGame        MessageType = "set_game"
+	MessageTypeRound          MessageType = "round"
+	MessageTypeVote           MessageType = "vote"
+	MessageTypeResume         MessageType = "resume"
+	MessageTypeDashboard      MessageType = "dashboard"
+	MessageTypeDashboardDelta MessageType = "dashboard_delta"
+	MessageTypePlayer         MessageType = "player"
+	MessageTypeAck            MessageType = "ack"
+	MessageTypeError          MessageType = "error"
+	MessageTypeRestart        MessageType = "restart"
+	MessageTypeReceipts       MessageType = "receipts"
+)
+
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest         ErrorCode = "bad_request"
+	ErrorCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrorCodeUnknownType        ErrorCode = "unknown_type"
+	ErrorCodeInternal           ErrorCode = "internal"
+	ErrorCodeGameOver           ErrorCode = "game_over"
+	ErrorCodeRoundMismatch      ErrorCode = "round_mismatch"
+	ErrorCodePlayerNotFound     ErrorCode = "player_not_found"
+	ErrorCodeAlreadyVoted       ErrorCode = "already_voted"
+	ErrorCodeCandidateNotFound  ErrorCode = "candidate_not_found"
+	ErrorCodeInvalidResumeToken ErrorCode = "invalid_resume_token"
+	ErrorCodeRateLimited        ErrorCode = "rate_limited"
+	ErrorCodeNoRunningRound     ErrorCode = "no_running_round"
+
+	// HINT: the codes below are only replied by the REST API.
+	ErrorCodeUnauthorized ErrorCode = "unauthorized"
+	ErrorCodeNotFound     ErrorCode = "not_found"
+	ErrorCodeConflict     ErrorCode = "conflict"
+	ErrorCodeRoomClosed   ErrorCode = "room_closed"
+	ErrorCodeUnavailable  ErrorCode = "unavailable"
+)
+
+var (
+	ErrBadRequest         = &Error{Code: ErrorCodeBadRequest, Message: "malformed message"}
+	ErrUnsupportedVersion = &Error{Code: ErrorCodeUnsupportedVersion, Message: "unsupported protocol version"}
+	ErrUnknownType        = &Error{Code: ErrorCodeUnknownType, Message: "unknown message type"}
+	ErrGameOver           = &Error{Code: ErrorCodeGameOver, Message: "game is over"}
+	ErrRoundMismatch      = &Error{Code: ErrorCodeRoundMismatch, Message: "round does not match the current round"}
+	ErrPlayerNotFound     = &Error{Code: ErrorCodePlayerNotFound, Message: "player not found"}
+	ErrAlreadyVoted       = &Error{Code: ErrorCodeAlreadyVoted, Message: "already voted in this round"}
+	ErrCandidateNotFound  = &Error{Code: ErrorCodeCandidateNotFound, Message: "candidate not found"}
+	ErrInvalidResumeToken = &Error{Code: ErrorCodeInvalidResumeToken, Message: "resume token is invalid or expired"}
+	ErrRateLimited        = &Error{Code: ErrorCodeRateLimited, Message: "too many messages, slow down"}
+	ErrNoRunningRound     = &Error{Code: ErrorCodeNoRunningRound, Message: "no round is running"}
+)
+
+// Error is the error reply of a rejected command.
+type Error struct {
+	Command MessageType `json:"command,omitempty"`
+	Code    ErrorCode   `json:"code"`
+	Message string      `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Ack is the reply of an accepted command.
+type Ack struct {
+	Command MessageType `json:"command"`
+	Vote    *Vote       `json:"vote,omitempty"`
+}
+
+// RestartNotice tells the clients the server is restarting. The socket is closed
+// right after it, clients reconnect once the server is back.
+type RestartNotice struct {
+	Message string `json:"message"`
+}
+
+// Vote is the choice stored for a vote. Duplicate is true when the vote ID was
+// already counted and the submission was ignored. Receipt is the code the
+// player looks up in the receipts published after the game is over.
+type Vote struct {
+	VoteID    string `json:"vote_id"`
+	Round     int    `json:"round"`
+	Candidate string `json:"candidate"`
+	Receipt   string `json:"receipt"`
+	Duplicate bool   `json:"duplicate"`
+}
+
+// toError converts any error returned by the handler of command into an Error reply.
+func toError(command MessageType, err error) *Error {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Code: ErrorCodeInternal, Message: err.Error()}
+	}
+
+	reply := *e
+	reply.Command = command
+
+	return &reply
+}
+
+// incomingCommands returns the commands carried by a message. Versioned messages
+// carry exactly the command named by their type, legacy messages carry one
+// command for every populated field.
+func incomingCommands(msgType MessageType, fields ...MessageType) []MessageType {
+	if len(msgType) != 0 {
+		return []MessageType{msgType}
+	}
+
+	commands := make([]MessageType, 0, len(fields))
+	for _, field := range fields {
+		if len(field) != 0 {
+			commands = append(commands, field)
+		}
+	}
+
+	return commands
+}
+
+func newHostReply(requestID string, command MessageType, err error) HostWsMessageOutgoing {
+	msg := HostWsMessageOutgoing{
+		Version:   _protocolVersion,
+		RequestID: requestID,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	if err != nil {
+		msg.Type = MessageTypeError
+		msg.Error = toError(command, err)
+	} else {
+		msg.Type = MessageTypeAck
+		msg.Ack = &Ack{Command: command}
+	}
+
+	return msg
+}
+
+func newPlayerReply(requestID string, command MessageType, ack *Ack, err error) PlayerWsMessageOutgoing {
+	msg := PlayerWsMessageOutgoing{
+		Version:   _protocolVersion,
+		RequestID: requestID,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	if err != nil {
+		msg.Type = MessageTypeError
+		msg.Error = toError(command, err)
+	} else {
+		if ack == nil {
+			ack = &Ack{}
+		}
+
+		ack.Command = command
+		msg.Type = MessageTypeAck
+		msg.Ack = ack
+	}
+
+	return msg
+}
@@ -0,0 +1,166 @@
+package room
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"main/internal/logger"
+)
+
+const _receiptSecretSize = 32
+
+var _receiptEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Ballot is the choice a player made in a round, with the receipt handed back
+// for it. VoteID is the ID the vote was sent with, empty when it had none.
+type Ballot struct {
+	Candidate string
+	Receipt   string
+	VoteID    string
+}
+
+// Receipt is a published receipt code with the choice it was recorded for.
+type Receipt struct {
+	Code          string `json:"code"`
+	Round         int    `json:"round"`
+	Candidate     string `json:"candidate"`
+	CandidateName string `json:"candidate_name"`
+}
+
+// ReceiptsResponse lists every receipt of a finished game, sorted by code so
+// the order tells nothing about who voted when.
+type ReceiptsResponse struct {
+	RoomID   string    `json:"room_id"`
+	Receipts []Receipt `json:"receipts"`
+}
+
+func newReceiptSecret() []byte {
+	secret := make([]byte, _receiptSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return secret
+}
+
+// receipt derives the receipt code of a ballot. The code is keyed by the secret
+// of the room, so nobody but the server can link a published code to a player.
+func (r *Room) receipt(uid string, round int, candidate string) string {
+	mac := hmac.New(sha256.New, r.receiptSecret)
+	mac.Write([]byte(r.RoomID + "\x00" + uid + "\x00" + strconv.Itoa(round) + "\x00" + candidate))
+	code := _receiptEncoding.EncodeToString(mac.Sum(nil))[:10]
+
+	return code[:5] + "-" + code[5:]
+}
+
+// publishReceipts collects the receipts of every ballot counted in the room and
+// sends them to the players and the host. It is called once the game is over.
+func (r *Room) publishReceipts() {
+	names := map[string]string{}
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		for id, c := range m {
+			names[id] = c.Name
+		}
+	})
+
+	receipts := []Receipt{}
+	for _, player := range r.playerTable.ValueSlice() {
+		player.VoteTable.Exec(func(m map[int]Ballot) {
+			for round, ballot := range m {
+				if len(ballot.Receipt) == 0 {
+					continue
+				}
+
+				receipts = append(receipts, Receipt{
+					Code:          ballot.Receipt,
+					Round:         round,
+					Candidate:     ballot.Candidate,
+					CandidateName: names[ballot.Candidate],
+				})
+			}
+		})
+	}
+
+	sort.Slice(receipts, func(i, j int) bool {
+		return receipts[i].Code < receipts[j].Code
+	})
+
+	r.receipts.Store(receipts)
+	r.l.Info("receipts published", "count", len(receipts))
+
+	r.BroadcastPlayers(receiptsMessage(receipts))
+
+	r.sendHost(HostWsMessageOutgoing{
+		Version:   _protocolVersion,
+		Type:      MessageTypeReceipts,
+		Receipts:  receipts,
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+// sendReceipts sends the published receipts to a player connecting after the
+// game is over.
+func (p *Player) sendReceipts(room *Room) {
+	if receipts, ok := room.Receipts(); ok {
+		p.send(receiptsMessage(receipts))
+	}
+}
+
+func receiptsMessage(receipts []Receipt) PlayerWsMessageOutgoing {
+	return PlayerWsMessageOutgoing{
+		Version:   _protocolVersion,
+		Type:      MessageTypeReceipts,
+		Receipts:  receipts,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// Receipts returns the published receipts, and false before the game is over.
+func (r *Room) Receipts() ([]Receipt, bool) {
+	receipts := r.receipts.Load()
+
+	return receipts, receipts != nil
+}
+
+func GetReceipts() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		roomID := r.PathValue("room_id")
+		room, ok := _roomPool.Load(roomID)
+		if !ok {
+			l.Warn("room not found", "room_id", roomID)
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		receipts, ok := room.Receipts()
+		if !ok {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("receipts are published after the game is over"))
+
+			return
+		}
+
+		response, err := json.Marshal(ReceiptsResponse{
+			RoomID:   room.RoomID,
+			Receipts: receipts,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
@@ -0,0 +1,137 @@
+package room
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// _closeSuperseded is the websocket close code sent to a player connection
+// replaced by a newer connection of the same player.
+const _closeSuperseded = 4000
+
+// playerSession is a websocket connection of a player. Only the newest session
+// of a player is kept, older ones are closed when a new one is attached.
+type playerSession struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+	l      *slog.Logger
+}
+
+func (s *playerSession) supersede() {
+	s.close(_closeSuperseded, "replaced by a newer connection")
+}
+
+func (s *playerSession) close(code int, reason string) {
+	s.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(_writeWait),
+	)
+	s.cancel()
+}
+
+// attachSession makes the session the current one of the player, closing the
+// previous session and dropping the messages queued for it.
+func (p *Player) attachSession(s *playerSession) {
+	if old := p.session.Swap(s); old != nil {
+		p.l.Info("close superseded connection")
+		old.supersede()
+	}
+
+	for {
+		select {
+		case <-p.Channel:
+		default:
+			return
+		}
+	}
+}
+
+// closeSession closes the current session of the player with code.
+func (p *Player) closeSession(code int, reason string) {
+	if s := p.session.Swap(nil); s != nil {
+		s.close(code, reason)
+	}
+}
+
+// detachSession clears the session if it is still the current one of the player.
+func (p *Player) detachSession(s *playerSession) bool {
+	detached := false
+	p.session.Exec(func(current **playerSession) {
+		if *current == s {
+			*current = nil
+			detached = true
+		}
+	})
+
+	return detached
+}
+
+// issueResumeToken rotates the resume token of the player.
+func (p *Player) issueResumeToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		p.l.Error("rand.Read", "error", err)
+		return ""
+	}
+
+	token := hex.EncodeToString(buf)
+	p.resumeToken.Store(token)
+
+	return token
+}
+
+func (p *Player) validResumeToken(token string) bool {
+	current := p.resumeToken.Load()
+	if len(current) == 0 || len(token) == 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(current), []byte(token)) == 1
+}
+
+// handlePlayerResume replies the state the player missed since the state it reports.
+func (p *Player) handlePlayerResume(room *Room, msg *PlayerWsMessageResumeIncoming) error {
+	if !p.validResumeToken(msg.Token) {
+		return ErrInvalidResumeToken
+	}
+
+	round := room.Round.Load()
+	voted, _ := p.VoteTable.Load(round)
+	limit := room.dashboardPlayerDisplayLimit.Load()
+	dashboard, seq := room.GetDashboard(limit)
+
+	resp := &PlayerWsMessageResumeResponse{
+		Round:        round,
+		RoundVoted:   voted.Candidate,
+		RoundReceipt: voted.Receipt,
+		EndTime:      room.RoundEndTime.Load(),
+		GameOver:     room.IsGameOver.Load(),
+		Seq:          seq,
+		ResumeToken:  p.issueResumeToken(),
+	}
+
+	if msg.Round != round {
+		resp.Candidates = room.GetCandidates()
+	}
+
+	if msg.Seq != seq {
+		resp.Dashboard = dashboard
+	}
+
+	p.send(PlayerWsMessageOutgoing{
+		Version:   _protocolVersion,
+		Type:      MessageTypeResume,
+		Resume:    resp,
+		Timestamp: time.Now().UnixMilli(),
+	})
+	p.sendReceipts(room)
+
+	return nil
+}
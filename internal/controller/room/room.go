@@ -1,12 +1,20 @@
 package room
 
 import (
+	"context"
+	"log/slog"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"main/internal/metrics"
+
 	"main/internal/utils"
+	"main/internal/webhook"
 
-	"github.com/yanun0323/pkg/logs"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
 )
 
 var (
@@ -14,12 +22,16 @@ var (
 	_defaultChannelSize        = 500
 	_defaultPlayerDisplayLimit = 3
 	_defaultCountdownDuration  = 15 * time.Second
+	_defaultBroadcastInterval  = 200 * time.Millisecond
 )
 
 type Room struct {
-	l                           logs.Logger
+	l                           *slog.Logger
 	RoomID                      string
 	Title                       string
+	Passcode                    string
+	RequireLogin                bool
+	AuditVoters                 bool
 	PlayerUpdate                chan struct{}
 	HostMsg                     chan HostWsMessageOutgoing
 	Round                       *utils.SyncValue[int]
@@ -27,15 +39,33 @@ type Room struct {
 	IsGameStart                 *utils.SyncValue[bool]
 	IsGameOver                  *utils.SyncValue[bool]
 	playerTable                 *utils.SyncMap[string, *Player]
+	inviteTokens                *utils.SyncMap[string, string]
+	subjects                    *utils.SyncMap[string, string]
 	dashboard                   *utils.SyncMap[string, *Candidate]
+	dashboardSeq                *utils.SyncValue[int64]
+	pendingDelta                map[string]int // guarded by dashboard's lock
+	broadcastStats              BroadcastStats // guarded by dashboard's lock
+	flushMu                     sync.Mutex     // serializes the delta flushes, so deltas go out in seq order
 	nickname                    *utils.NicknamePool
 	countdown                   *utils.SyncValue[time.Duration]
 	dashboardPlayerDisplayLimit *utils.SyncValue[int]
+	lifecycle                   *utils.SyncValue[lifecycle]
+	receiptSecret               []byte
+	receipts                    *utils.SyncValue[[]Receipt]
+	results                     *utils.SyncValue[*Results]
+	hooks                       *webhook.Dispatcher
+	endedRound                  *utils.SyncValue[int]
+	hostConns                   atomic.Int64
+	droppedMessages             atomic.Int64
+	instance                    string // tells apart the rooms reusing a room ID in the audit log
+	ctx                         context.Context
+	cancel                      context.CancelCauseFunc
 }
 
 func NewRoom(roomID string, title string) *Room {
-	return &Room{
-		l:                           logs.New(logs.LevelDebug).WithField("room", roomID),
+	ctx, cancel := context.WithCancelCause(context.Background())
+	r := &Room{
+		l:                           slog.Default().With("room_id", roomID),
 		RoomID:                      roomID,
 		Title:                       title,
 		PlayerUpdate:                make(chan struct{}, _defaultChannelSize),
@@ -45,42 +75,127 @@ func NewRoom(roomID string, title string) *Room {
 		IsGameStart:                 utils.NewSyncValue(false),
 		IsGameOver:                  utils.NewSyncValue(false),
 		playerTable:                 utils.NewSyncMap[string, *Player](),
+		inviteTokens:                utils.NewSyncMap[string, string](),
+		subjects:                    utils.NewSyncMap[string, string](),
 		dashboard:                   utils.NewSyncMap[string, *Candidate](),
+		dashboardSeq:                utils.NewSyncValue[int64](0),
+		pendingDelta:                map[string]int{},
 		nickname:                    utils.NewNicknamePool(),
 		countdown:                   utils.NewSyncValue(_defaultCountdownDuration),
 		dashboardPlayerDisplayLimit: utils.NewSyncValue(_defaultPlayerDisplayLimit),
+		lifecycle:                   utils.NewSyncValue(lifecycle{State: StateCreated, Since: time.Now()}),
+		receiptSecret:               newReceiptSecret(),
+		instance:                    randomString(),
+		receipts:                    utils.NewSyncValue[[]Receipt](nil),
+		results:                     utils.NewSyncValue[*Results](nil),
+		endedRound:                  utils.NewSyncValue(0),
+		ctx:                         ctx,
+		cancel:                      cancel,
+	}
+
+	interval := viper.GetDuration("room.broadcast_interval")
+	if interval <= 0 {
+		interval = _defaultBroadcastInterval
 	}
+
+	go r.runBroadcaster(ctx, interval)
+
+	return r
 }
 
-func (r *Room) BroadcastDashboardUpdate(skipHost ...bool) {
-	sli := r.playerTable.ValueSlice()
-	for _, player := range sli {
-		player.Channel <- PlayerWsMessageOutgoing{
-			Dashboard: &PlayerWsMessageDashboardResponse{
-				Dashboard: r.GetDashboard(r.dashboardPlayerDisplayLimit.Load()),
-				GameOver:  r.IsGameOver.Load(),
-			},
-			Timestamp: time.Now().UnixMilli(),
-		}
+// Close stops the background goroutines of the room.
+func (r *Room) Close() {
+	r.stop(_reasonArchived)
+}
+
+// stop stops the background goroutines of the room, the host connections are
+// closed with reason.
+func (r *Room) stop(reason *closeReason) {
+	r.cancel(reason)
+}
+
+// NotifyPlayerUpdate tells the host the player list changed. It never blocks,
+// a pending notification already covers the change.
+func (r *Room) NotifyPlayerUpdate() {
+	select {
+	case r.PlayerUpdate <- struct{}{}:
+	default:
 	}
+}
+
+func (r *Room) BroadcastDashboardUpdate(skipHost ...bool) {
+	start := time.Now()
+	defer func() { metrics.BroadcastDuration.WithLabelValues("snapshot").Observe(time.Since(start).Seconds()) }()
+
+	playerDashboard, seq := r.GetDashboard(r.dashboardPlayerDisplayLimit.Load())
+	r.BroadcastPlayers(PlayerWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeDashboard,
+		Dashboard: &PlayerWsMessageDashboardResponse{
+			Seq:       seq,
+			Dashboard: playerDashboard,
+			GameOver:  r.IsGameOver.Load(),
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
 
 	if len(skipHost) != 0 && skipHost[0] {
 		return
 	}
 
-	r.HostMsg <- HostWsMessageOutgoing{
+	dashboard, seq := r.GetDashboard()
+	r.sendHost(HostWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeDashboard,
 		Dashboard: &HostWsMessageDashboardResponse{
-			Dashboard: r.GetDashboard(),
+			Seq:       seq,
+			Dashboard: dashboard,
 			GameOver:  r.IsGameOver.Load(),
 		},
 		Timestamp: time.Now().UnixMilli(),
-	}
+	})
 }
 
+// BroadcastDashboardDelta sends only the changed candidates to players and host.
+// Clients apply the delta when seq follows the last one they saw, and request a
+// full snapshot through the connect handshake when they detect a gap.
+func (r *Room) BroadcastDashboardDelta(seq int64, changed []*Candidate) {
+	start := time.Now()
+	defer func() { metrics.BroadcastDuration.WithLabelValues("delta").Observe(time.Since(start).Seconds()) }()
+
+	gameOver := r.IsGameOver.Load()
+	r.BroadcastPlayers(PlayerWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeDashboardDelta,
+		DashboardDelta: &PlayerWsMessageDashboardDeltaResponse{
+			Seq:        seq,
+			Candidates: changed,
+			GameOver:   gameOver,
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
+
+	r.sendHost(HostWsMessageOutgoing{
+		Version: _protocolVersion,
+		Type:    MessageTypeDashboardDelta,
+		DashboardDelta: &HostWsMessageDashboardDeltaResponse{
+			Seq:        seq,
+			Candidates: changed,
+			GameOver:   gameOver,
+		},
+		Timestamp: time.Now().UnixMilli(),
+	})
+}
+
+// BroadcastPlayers queues msg for every player. It never blocks, the message is
+// dropped for a player whose queue is full, such as an offline player. The
+// player catches up with the state of the room when it resumes.
 func (r *Room) BroadcastPlayers(msg PlayerWsMessageOutgoing) {
 	sli := r.playerTable.ValueSlice()
 	for _, player := range sli {
-		player.Channel <- msg
+		if !player.send(msg) {
+			r.droppedMessages.Add(1)
+		}
 	}
 }
 
@@ -90,6 +205,7 @@ func (r *Room) AddPlayer(player *Player) {
 	} else {
 		player.Name = player.UID
 	}
+	player.l = r.l.With("player", player.UID)
 	r.playerTable.Store(player.UID, player)
 }
 
@@ -109,8 +225,21 @@ func (r *Room) GetPlayerNames() []string {
 	return names
 }
 
-func (r *Room) GetDashboard(limit ...int) []*Candidate {
-	d := r.dashboard.ValueSlice()
+// GetDashboard returns a sorted copy of the dashboard and the sequence number it reflects.
+func (r *Room) GetDashboard(limit ...int) ([]*Candidate, int64) {
+	var (
+		d   []*Candidate
+		seq int64
+	)
+
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		d = make([]*Candidate, 0, len(m))
+		for _, c := range m {
+			cp := *c
+			d = append(d, &cp)
+		}
+		seq = r.dashboardSeq.Load()
+	})
 
 	sort.Slice(d, func(i, j int) bool {
 		if d[i].Score != d[j].Score {
@@ -121,14 +250,23 @@ func (r *Room) GetDashboard(limit ...int) []*Candidate {
 	})
 
 	if len(limit) != 0 && limit[0] > 0 && limit[0] < len(d) {
-		return d[:limit[0]]
+		return d[:limit[0]], seq
 	}
 
-	return d
+	return d, seq
 }
 
+// GetCandidates returns a copy of the candidates sorted by their order. The
+// copies can be marshalled while votes change the scores.
 func (r *Room) GetCandidates() []*Candidate {
-	d := r.dashboard.ValueSlice()
+	var d []*Candidate
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		d = make([]*Candidate, 0, len(m))
+		for _, c := range m {
+			cp := *c
+			d = append(d, &cp)
+		}
+	})
 
 	sort.Slice(d, func(i, j int) bool {
 		return d[i].Order < d[j].Order
@@ -137,45 +275,123 @@ func (r *Room) GetCandidates() []*Candidate {
 	return d
 }
 
-func (r *Room) StoreCandidates(cds map[string]*Candidate) {
-	r.dashboard.Stores(cds)
+// StoreCandidates adds the candidates without an ID, with new IDs after the
+// current ones, and renames the candidates with an ID. An unknown ID fails with
+// ErrCandidateNotFound and changes nothing. Scores are never changed.
+func (r *Room) StoreCandidates(cds []*Candidate) error {
+	var err error
+	r.dashboard.Exec(func(m map[string]*Candidate) {
+		for _, candidate := range cds {
+			if _, ok := m[candidate.ID]; len(candidate.ID) != 0 && !ok {
+				err = ErrCandidateNotFound
+				return
+			}
+		}
+
+		order := len(m)
+		for _, candidate := range cds {
+			if len(candidate.Name) == 0 {
+				continue
+			}
+
+			if current, ok := m[candidate.ID]; ok {
+				current.Name = candidate.Name
+				continue
+			}
+
+			id := uuid.NewString()
+			m[id] = &Candidate{ID: id, Order: order, Name: candidate.Name}
+			order++
+		}
+		r.nextDashboardSeq()
+	})
+
+	return err
 }
 
-func (r *Room) VoteCandidate(uid string, round int, candidate string) {
-	l := r.l.WithField("voter", uid).WithField("round", round).WithField("candidate", candidate)
+// nextDashboardSeq bumps the dashboard sequence number. It must be called while
+// the dashboard is locked, so sequence numbers follow the order of score changes.
+func (r *Room) nextDashboardSeq() int64 {
+	seq := r.dashboardSeq.Load() + 1
+	r.dashboardSeq.Store(seq)
+
+	return seq
+}
+
+// VoteCandidate counts the vote of a player and returns the stored choice.
+// A non-empty voteID makes the submission idempotent: re-sending a vote ID that
+// was already counted returns the stored choice without counting it again.
+func (r *Room) VoteCandidate(uid string, round int, candidate string, voteID string) (vote *Vote, err error) {
+	defer func() {
+		observeVote(vote, err)
+		if err != nil || vote.Duplicate {
+			r.auditRejected(uid, round, candidate, vote, err)
+		}
+	}()
+
+	l := r.l.With("voter", uid, "round", round, "candidate", candidate, "vote_id", voteID)
+	player, ok := r.GetPlayer(uid)
+	if !ok {
+		l.Debug("player not found, skip voting")
+		return nil, ErrPlayerNotFound
+	}
+
+	if len(voteID) != 0 {
+		if votedRound, voted, ok := player.ballotOf(voteID); ok {
+			l.Debug("vote id already counted, skip voting")
+			return &Vote{VoteID: voteID, Round: votedRound, Candidate: voted.Candidate, Receipt: voted.Receipt, Duplicate: true}, nil
+		}
+	}
+
 	if r.IsGameOver.Load() {
 		l.Debug("game over, skip voting")
-		return
+		return nil, ErrGameOver
 	}
 
 	if r.Round.Load() != round {
 		l.Debug("round not match, skip voting")
-		return
+		return nil, ErrRoundMismatch
 	}
 
-	player, ok := r.GetPlayer(uid)
-	if !ok {
-		l.Debug("player not found, skip voting")
-		return
+	if time.Now().UnixMilli() >= r.RoundEndTime.Load() {
+		l.Debug("round ended or stopped, skip voting")
+		return nil, ErrNoRunningRound
 	}
 
-	voted, ok := player.VoteTable.Load(round)
-	if ok && len(voted) != 0 {
-		l.Debug("round already voted, skip voting")
-		return
+	if _, ok := r.dashboard.Load(candidate); !ok {
+		l.Debug("candidate not found, skip voting")
+		return nil, ErrCandidateNotFound
 	}
 
-	r.dashboard.Do(candidate, func(d *Candidate) {
-		r.l.Debug("candidate: ", candidate, ", uid: ", uid, ", round: ", round)
-		if d.ID != candidate {
-			l.Debug("candidate not found, skip voting")
-			return
+	// HINT: the vote ID is stored with the ballot, a retry racing the first
+	// submission finds it there and gets the same duplicate ack.
+	ballot := Ballot{Candidate: candidate, Receipt: r.receipt(uid, round, candidate), VoteID: voteID}
+	if voted, loaded := player.VoteTable.LoadOrStore(round, ballot); loaded && len(voted.Candidate) != 0 {
+		if len(voteID) != 0 && voted.VoteID == voteID {
+			l.Debug("vote id already counted, skip voting")
+			return &Vote{VoteID: voteID, Round: round, Candidate: voted.Candidate, Receipt: voted.Receipt, Duplicate: true}, nil
 		}
 
+		l.Debug("round already voted, skip voting")
+		return nil, ErrAlreadyVoted
+	}
+
+	found := false
+	r.dashboard.Do(candidate, func(d *Candidate) {
+		l.Debug("vote counted")
 		d.Score++
+		r.markDashboardDelta(d.ID)
+		r.auditVote(uid, round, candidate)
+		found = true
 	})
 
-	player.VoteTable.Store(round, candidate)
+	if !found {
+		// HINT: the candidates were replaced while voting, roll the vote back.
+		l.Debug("candidate not found, skip voting")
+		player.VoteTable.Delete(round)
+
+		return nil, ErrCandidateNotFound
+	}
 
-	r.BroadcastDashboardUpdate()
+	return &Vote{VoteID: voteID, Round: round, Candidate: candidate, Receipt: ballot.Receipt}, nil
 }
@@ -0,0 +1,169 @@
+package room
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"main/internal/logger"
+	"main/internal/session"
+	"main/internal/webhook"
+)
+
+type (
+	RoomCreatedEvent struct {
+		Title string `json:"title"`
+	}
+
+	RoundStartedEvent struct {
+		Round   int   `json:"round"`
+		EndTime int64 `json:"end_time"`
+	}
+
+	// RoundEndedEvent carries the votes of the round, Dashboard is the score
+	// accumulated over every round so far.
+	RoundEndedEvent struct {
+		Round     int            `json:"round"`
+		Voters    int            `json:"voters"`
+		Players   int            `json:"players"`
+		Votes     map[string]int `json:"votes"`
+		Dashboard []*Candidate   `json:"dashboard"`
+	}
+
+	GameOverEvent struct {
+		Title     string       `json:"title"`
+		Rounds    int          `json:"rounds"`
+		Players   int          `json:"players"`
+		Dashboard []*Candidate `json:"dashboard"`
+		Tallies   []RoundTally `json:"tallies"`
+	}
+
+	PlayerJoinedEvent struct {
+		Name    string `json:"name"`
+		Players int    `json:"players"`
+	}
+)
+
+// WebhooksResponse lists the webhooks of a room and their delivery log.
+type WebhooksResponse struct {
+	Endpoints  []webhook.Endpoint `json:"endpoints"`
+	Deliveries []webhook.Delivery `json:"deliveries"`
+}
+
+// roundVotes counts the votes of round by candidate, and the players who voted.
+func (r *Room) roundVotes(round int) (map[string]int, int) {
+	votes := map[string]int{}
+	voters := 0
+	for _, player := range r.playerTable.ValueSlice() {
+		if ballot, ok := player.VoteTable.Load(round); ok && len(ballot.Candidate) != 0 {
+			votes[ballot.Candidate]++
+			voters++
+		}
+	}
+
+	return votes, voters
+}
+
+// startRound fires the round started event, and the round ended event once the
+// countdown of the round is over.
+func (r *Room) startRound(round int, endTime int64) {
+	if r.hooks == nil {
+		return
+	}
+
+	r.hooks.Fire(webhook.EventRoundStarted, RoundStartedEvent{Round: round, EndTime: endTime})
+	time.AfterFunc(time.Until(time.UnixMilli(endTime)), func() {
+		if !r.IsClosed() {
+			r.endRound(round)
+		}
+	})
+}
+
+// endRound fires the round ended event of round, once.
+func (r *Room) endRound(round int) {
+	if r.hooks == nil || round == 0 {
+		return
+	}
+
+	ended := false
+	r.endedRound.Exec(func(last *int) {
+		if *last >= round {
+			ended = true
+			return
+		}
+
+		*last = round
+	})
+
+	if ended {
+		return
+	}
+
+	votes, voters := r.roundVotes(round)
+	dashboard, _ := r.GetDashboard()
+	r.hooks.Fire(webhook.EventRoundEnded, RoundEndedEvent{
+		Round:     round,
+		Voters:    voters,
+		Players:   r.playerTable.Len(),
+		Votes:     votes,
+		Dashboard: dashboard,
+	})
+}
+
+// fireGameOver ends the running round and fires the game over event with the
+// results, without the ballots.
+func (r *Room) fireGameOver() {
+	if r.hooks == nil {
+		return
+	}
+
+	r.endRound(r.Round.Load())
+	res, ok := r.Results()
+	if !ok {
+		return
+	}
+
+	dashboard, _ := r.GetDashboard()
+	r.hooks.Fire(webhook.EventGameOver, GameOverEvent{
+		Title:     res.Title,
+		Rounds:    res.Rounds,
+		Players:   res.Players,
+		Dashboard: dashboard,
+		Tallies:   res.Tallies,
+	})
+}
+
+func GetWebhooks() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := logger.FromContext(r.Context())
+		roomID := r.PathValue("room_id")
+		room, ok := _roomPool.Load(roomID)
+		if !ok {
+			l.Warn("room not found", "room_id", roomID)
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if !session.VerifyHost(r, room.RoomID) {
+			l.Warn("GetWebhooks, host token is invalid", "room_id", roomID)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		response, err := json.Marshal(WebhooksResponse{
+			Endpoints:  room.hooks.Endpoints(),
+			Deliveries: room.hooks.Deliveries(),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(response)
+	}
+}
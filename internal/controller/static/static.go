@@ -0,0 +1,34 @@
+package static
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"main/internal/resource"
+)
+
+const _immutable = "public, max-age=31536000, immutable"
+
+// Static serves the embedded assets on their versioned paths. A hash which
+// doesn't match the current content is not found, so a stale path is never
+// cached with new content.
+func Static() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		asset, ok := resource.LoadAsset(r.PathValue("path"))
+		if !ok || asset.Hash != r.PathValue("hash") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if contentType := mime.TypeByExtension(path.Ext(asset.Name)); len(contentType) != 0 {
+			w.Header().Set("Content-Type", contentType)
+		}
+
+		w.Header().Set("Cache-Control", _immutable)
+		w.Header().Set("ETag", `"`+asset.Hash+`"`)
+		http.ServeContent(w, r, asset.Name, time.Time{}, bytes.NewReader(asset.Body))
+	}
+}
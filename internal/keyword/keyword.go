@@ -1,19 +0,0 @@
-package keyword
-
-const (
-	Host            = "%HOST%"
-	Wss             = "%WSS%"
-	UID             = "%UID%"
-	QRCode          = "%QRCODE%"
-	RoomLink        = "%ROOM_LINK%"
-	RoomID          = "%ROOM_ID%"
-	RoomStarted     = "%ROOM_STARTED%"
-	RoomTitle       = "%ROOM_TITLE%"
-	RoomRound       = "%ROOM_ROUND%"
-	RoomEndTime     = "%ROOM_END_TIME%"
-	RoomGameOver    = "%ROOM_GAME_OVER%"
-	RoomDashboard   = "%ROOM_DASHBOARD%"
-	RoomCandidates  = "%ROOM_CANDIDATES%"
-	RoomPlayerVoted = "%ROOM_VOTED%"
-	RoomPlayerName  = "%ROOM_PLAYER_NAME%"
-)
@@ -0,0 +1,139 @@
+package logger
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// RequestIDHeader carries the request ID, a request ID sent by the client or a
+// proxy is kept, otherwise a new one is generated.
+const RequestIDHeader = "X-Request-ID"
+
+var _validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type contextKey struct{}
+
+// Init replaces the default slog logger with the one configured in log:
+//
+//	log:
+//	  level: info       # debug, info, warn or error
+//	  format: text      # text or json
+//	  output: stdout    # stdout, stderr or a file path
+//	  sampling:
+//	    rate: 1         # share of the debug and info records kept, warn and above are always kept
+func Init() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(viper.GetString("log.level"))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	output, err := openOutput(viper.GetString("log.output"))
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(viper.GetString("log.format")) {
+	case "json":
+		handler = slog.NewJSONHandler(output, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(output, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", viper.GetString("log.format"))
+	}
+
+	if viper.IsSet("log.sampling.rate") {
+		if rate := viper.GetFloat64("log.sampling.rate"); rate < 1 {
+			handler = &samplingHandler{Handler: handler, rate: rate}
+		}
+	}
+
+	slog.SetDefault(slog.New(handler))
+
+	return nil
+}
+
+func openOutput(output string) (io.Writer, error) {
+	switch output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	}
+}
+
+// samplingHandler keeps only a share of the records below warn, so the per
+// message debug logs of a busy event don't flood the output.
+type samplingHandler struct {
+	slog.Handler
+	rate float64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < slog.LevelWarn && rand.Float64() >= h.rate {
+		return nil
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), rate: h.rate}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), rate: h.rate}
+}
+
+// Middleware tags the request with a request ID, and puts a logger carrying it
+// into the request context.
+func Middleware(fn func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !_validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		l := slog.Default().With("request_id", id)
+		fn(w, r.WithContext(WithContext(r.Context(), l)))
+	}
+}
+
+// WithContext returns a copy of ctx carrying l.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger of ctx, or the default logger when ctx has none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := crand.Read(buf); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/viper"
+)
+
+const _namespace = "vote"
+
+var (
+	// VotesAccepted counts the votes counted on the dashboard.
+	VotesAccepted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "votes_accepted_total",
+		Help:      "Votes counted on the dashboard.",
+	})
+
+	// VotesRejected counts the votes which were not counted, by reason.
+	VotesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "votes_rejected_total",
+		Help:      "Votes not counted, by reason.",
+	}, []string{"reason"})
+
+	// UpgradeFailures counts the websocket upgrades which failed, by role.
+	UpgradeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "websocket_upgrade_failures_total",
+		Help:      "Websocket upgrades which failed, by role.",
+	}, []string{"role"})
+
+	// BroadcastDuration observes how long a dashboard broadcast takes to reach
+	// the queues of the host and every player, by kind.
+	BroadcastDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: _namespace,
+		Name:      "broadcast_duration_seconds",
+		Help:      "Time to enqueue a dashboard broadcast for the host and every player.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"kind"})
+
+	// WebhookDeliveries counts the webhook delivery attempts, by event and result.
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: _namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts, by event and result: delivered, retried, failed or dropped.",
+	}, []string{"event", "result"})
+)
+
+// Handler serves the metrics. When metrics.secret is set, scrapes must send it
+// as a bearer token.
+func Handler() func(w http.ResponseWriter, r *http.Request) {
+	handler := promhttp.Handler()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token := viper.GetString("metrics.secret"); len(token) != 0 {
+			auth := []byte(r.Header.Get("Authorization"))
+			if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	}
+}
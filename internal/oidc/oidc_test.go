@@ -0,0 +1,198 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	_testClientID = "vote"
+	_testKid      = "test-key"
+)
+
+// mockIdP is a local identity provider serving discovery, JWKS and a token
+// endpoint which returns the ID token set by the test.
+type mockIdP struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	idToken string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(discovery{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JwksURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": _testKid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if id, _, ok := r.BasicAuth(); !ok || id != _testClientID || r.FormValue("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// sign returns an RS256 ID token of claims signed with key.
+func (m *mockIdP) sign(t *testing.T, key *rsa.PrivateKey, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": _testKid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockIdP) claims() map[string]any {
+	return map[string]any{
+		"iss":   m.URL,
+		"sub":   "alice",
+		"aud":   _testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "good-nonce",
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		key    *rsa.PrivateKey
+		change func(map[string]any)
+		code   string
+		nonce  string
+		want   string
+	}{
+		{name: "good", want: "alice"},
+		{name: "audience list", change: func(c map[string]any) { c["aud"] = []string{"other", _testClientID} }, want: "alice"},
+		{name: "bad signature", key: otherKey},
+		{name: "bad nonce", nonce: "other-nonce"},
+		{name: "bad audience", change: func(c map[string]any) { c["aud"] = "other" }},
+		{name: "bad issuer", change: func(c map[string]any) { c["iss"] = "https://evil.example" }},
+		{name: "expired", change: func(c map[string]any) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "empty subject", change: func(c map[string]any) { c["sub"] = "" }},
+		{name: "bad code", code: "bad-code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := idp.claims()
+			if tt.change != nil {
+				tt.change(claims)
+			}
+
+			key := tt.key
+			if key == nil {
+				key = idp.key
+			}
+
+			code, nonce := tt.code, tt.nonce
+			if len(code) == 0 {
+				code = "good-code"
+			}
+
+			if len(nonce) == 0 {
+				nonce = "good-nonce"
+			}
+
+			idp.idToken = idp.sign(t, key, claims)
+			p := NewProvider(idp.URL, _testClientID, "secret", "http://localhost/auth/callback")
+
+			got, err := p.Exchange(context.Background(), code, nonce)
+			if len(tt.want) == 0 {
+				if err == nil {
+					t.Fatalf("Exchange() = %+v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+
+			if got.Subject != tt.want {
+				t.Errorf("Exchange() subject = %q, want %q", got.Subject, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	idp := newMockIdP(t)
+	p := NewProvider(idp.URL, _testClientID, "secret", "")
+
+	header, _ := json.Marshal(map[string]string{"alg": "none", "kid": _testKid})
+	payload, _ := json.Marshal(idp.claims())
+	token := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+
+	if _, err := p.Verify(context.Background(), token, "good-nonce"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	p := NewProvider(idp.URL, _testClientID, "secret", "http://localhost/auth/callback")
+
+	got, err := p.AuthCodeURL(context.Background(), "the-state", "the-nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := idp.URL + "/authorize?client_id=vote&nonce=the-nonce&redirect_uri=http%3A%2F%2Flocalhost%2Fauth%2Fcallback&response_type=code&scope=openid+profile+email&state=the-state"
+	if got != want {
+		t.Errorf("AuthCodeURL() = %q, want %q", got, want)
+	}
+}
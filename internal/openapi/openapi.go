@@ -0,0 +1,265 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Route is an API endpoint. The spec is generated from the routes the server
+// registers, so it can't drift from the handlers.
+type Route struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	// Auth marks routes requiring the host token as a bearer token.
+	Auth  bool
+	Query []Param
+	// Request is a value of the request body type, nil for routes without a body.
+	Request any
+	// Response is a value of the body type replied with Status.
+	Response any
+	Status   int
+	Handler  func(w http.ResponseWriter, r *http.Request)
+}
+
+// Param is a query parameter of a route.
+type Param struct {
+	Name        string
+	Description string
+	Type        string
+}
+
+// Pattern returns the pattern the route is registered with on a ServeMux.
+func (r Route) Pattern() string {
+	return r.Method + " " + r.Path
+}
+
+var _pathParam = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Spec returns the OpenAPI 3 document of routes. Error is a value of the body
+// type replied on errors.
+func Spec(title, version string, routes []Route, errorBody any) map[string]any {
+	g := &generator{schemas: map[string]any{}}
+	errorSchema := g.schema(reflect.TypeOf(errorBody))
+
+	paths := map[string]map[string]any{}
+	for _, route := range routes {
+		op := map[string]any{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+		}
+
+		if len(route.Description) != 0 {
+			op["description"] = route.Description
+		}
+
+		params := []any{}
+		for _, m := range _pathParam.FindAllStringSubmatch(route.Path, -1) {
+			params = append(params, map[string]any{
+				"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+
+		for _, q := range route.Query {
+			typ := q.Type
+			if len(typ) == 0 {
+				typ = "string"
+			}
+
+			params = append(params, map[string]any{
+				"name": q.Name, "in": "query", "description": q.Description, "schema": map[string]any{"type": typ},
+			})
+		}
+
+		if len(params) != 0 {
+			op["parameters"] = params
+		}
+
+		if route.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(route.Request))),
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		responses := map[string]any{
+			strconv.Itoa(status): map[string]any{
+				"description": http.StatusText(status),
+				"content":     jsonContent(g.schema(reflect.TypeOf(route.Response))),
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content":     jsonContent(errorSchema),
+			},
+		}
+		op["responses"] = responses
+
+		if route.Auth {
+			op["security"] = []any{map[string]any{"hostToken": []string{}}}
+		}
+
+		path := _pathParam.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info":    map[string]any{"title": title, "version": version},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"hostToken": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The host_token returned when the room is created.",
+				},
+			},
+		},
+	}
+}
+
+// Handler serves the spec as JSON.
+func Handler(spec map[string]any) func(w http.ResponseWriter, r *http.Request) {
+	body, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// operationID derives an operation ID such as getRoomsDashboard from the route.
+func operationID(route Route) string {
+	id := strings.ToLower(route.Method)
+	for _, part := range strings.Split(route.Path, "/") {
+		if len(part) == 0 || part == "api" || strings.HasPrefix(part, "{") {
+			continue
+		}
+
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return id
+}
+
+type generator struct {
+	schemas map[string]any
+}
+
+var _timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of t. Named structs are added to the
+// components and referenced.
+func (g *generator) schema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == _timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return g.object(t)
+		}
+
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = map[string]any{} // HINT: placeholder for recursive types.
+			g.schemas[t.Name()] = g.object(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// object returns the schema of struct t. Properties are not marked required,
+// the same types are used in requests, where zero values are defaults.
+func (g *generator) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	g.fields(t, properties)
+
+	return map[string]any{"type": "object", "properties": properties}
+}
+
+// fields adds the JSON fields of struct t, following encoding/json: embedded
+// structs without a tag are inlined.
+func (g *generator) fields(t reflect.Type, properties map[string]any) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && len(name) == 0 {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties)
+				continue
+			}
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		properties[name] = g.schema(f.Type)
+	}
+}
@@ -0,0 +1,157 @@
+package page
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"main/internal/resource"
+	"main/internal/utils"
+
+	"github.com/spf13/viper"
+)
+
+// Page names, the file names under the resource folder.
+const (
+	HomePage = "homepage.html"
+	Room     = "room.html"
+	Player   = "player.html"
+	Host     = "host.html"
+)
+
+// HINT: Vue uses {{ }} in the pages, so the templates use [[ ]] instead.
+const (
+	_leftDelim  = "[["
+	_rightDelim = "]]"
+	_pattern    = "*.html"
+)
+
+// _vendored are the assets loaded by every page, fetched by make assets.
+var _vendored = []string{"vendor/vue.esm-browser.prod.js", "vendor/axios.min.js"}
+
+var (
+	_templates = utils.NewSyncValue[*template.Template](nil)
+	_hotReload = utils.NewSyncValue(false)
+)
+
+// Init parses the embedded pages. With dev.hot_reload set, the pages are parsed
+// from disk on every render instead, so edits show up without a rebuild.
+func Init() error {
+	for _, name := range _vendored {
+		if _, ok := resource.LoadAsset(name); !ok {
+			return fmt.Errorf("asset %s is not vendored, run make assets", name)
+		}
+	}
+
+	if viper.GetBool("dev.hot_reload") {
+		slog.Warn("page hot reload enabled, pages are read from disk", "dir", resource.Dir)
+		_hotReload.Store(true)
+
+		_, err := parse(os.DirFS(resource.Dir))
+		return err
+	}
+
+	tmpl, err := parse(resource.FS)
+	if err != nil {
+		return err
+	}
+
+	_templates.Store(tmpl)
+
+	return nil
+}
+
+func parse(fsys fs.FS) (*template.Template, error) {
+	return template.New("").Delims(_leftDelim, _rightDelim).Funcs(template.FuncMap{
+		"asset": asset,
+	}).ParseFS(fsys, _pattern)
+}
+
+// asset returns the versioned path of the embedded static file name. The pages
+// never load a file from another origin, so a missing file fails the render.
+func asset(name string) (string, error) {
+	a, ok := resource.LoadAsset(name)
+	if !ok {
+		return "", fmt.Errorf("asset %s is not embedded", name)
+	}
+
+	return a.Path(), nil
+}
+
+func templates() (*template.Template, error) {
+	if _hotReload.Load() {
+		return parse(os.DirFS(resource.Dir))
+	}
+
+	if tmpl := _templates.Load(); tmpl != nil {
+		return tmpl, nil
+	}
+
+	tmpl, err := parse(resource.FS)
+	if err != nil {
+		return nil, err
+	}
+
+	_templates.Store(tmpl)
+
+	return tmpl, nil
+}
+
+type HomePageData struct {
+	Host         string
+	UID          string
+	LoginEnabled bool
+}
+
+type RoomData struct {
+	Host        string
+	UID         string
+	RoomID      string
+	RoomTitle   string
+	RoomStarted bool
+	RoomLocked  bool
+}
+
+type PlayerData struct {
+	Host      string
+	Wss       string
+	RoomID    string
+	RoomTitle string
+}
+
+type HostData struct {
+	Host         string
+	Wss          string
+	RoomID       string
+	RoomTitle    string
+	RoomLink     string
+	RoomPasscode string
+	QRCode       template.URL
+}
+
+// Render executes the page with data. The page is rendered into a buffer first,
+// so a failed execution never writes a partial page.
+func Render(w http.ResponseWriter, name string, data any) {
+	tmpl, err := templates()
+	if err != nil {
+		slog.Error("parse templates", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
+		slog.Error("tmpl.ExecuteTemplate", "page", name, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,227 @@
+package ratelimit
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const _sweepInterval = time.Minute
+
+// Limiter is a token bucket limiter keyed by an arbitrary string, such as an IP
+// address or a room ID. A Limiter with zero rate allows everything.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a limiter refilling rate tokens per second up to burst tokens.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of key, it reports false when the bucket is empty.
+func (l *Limiter) Allow(key string) bool {
+	if l == nil || l.rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// RetryAfter returns the time needed to refill one token.
+func (l *Limiter) RetryAfter() time.Duration {
+	if l == nil || l.rate <= 0 {
+		return 0
+	}
+
+	return time.Duration(float64(time.Second) / l.rate)
+}
+
+// sweep drops the buckets which are full again, it must be called with the lock held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < _sweepInterval {
+		return
+	}
+
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Scopes of the client limit of a policy.
+const (
+	// ScopeIP limits the requests of a client IP. The phones of a venue often
+	// share one IP behind NAT, so it only suits requests which are rare per room.
+	ScopeIP = "ip"
+	// ScopePlayer limits the messages of one player or host connection.
+	ScopePlayer = "player"
+)
+
+// Policy limits one kind of request both per client and per room. The client
+// is an IP or a player, as told by Scope.
+type Policy struct {
+	Name   string
+	Scope  string
+	Client *Limiter
+	Room   *Limiter
+}
+
+// NewPolicy reads the limits of name from the config:
+//
+//	rate_limit:
+//	  <name>:
+//	    <scope>: { rate: 1, burst: 10 }
+//	    room:    { rate: 5, burst: 50 }
+//
+// Missing limits fall back to defaultClient and defaultRoom, a rate of 0 disables the limit.
+func NewPolicy(name, scope string, defaultClient, defaultRoom Limit) *Policy {
+	return &Policy{
+		Name:   name,
+		Scope:  scope,
+		Client: limitFromConfig("rate_limit."+name+"."+scope, defaultClient).limiter(),
+		Room:   limitFromConfig("rate_limit."+name+".room", defaultRoom).limiter(),
+	}
+}
+
+// Limit is the rate in tokens per second and the burst of a limiter.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) limiter() *Limiter {
+	return NewLimiter(l.Rate, l.Burst)
+}
+
+func limitFromConfig(key string, def Limit) Limit {
+	if viper.IsSet(key + ".rate") {
+		def.Rate = viper.GetFloat64(key + ".rate")
+	}
+
+	if viper.IsSet(key + ".burst") {
+		def.Burst = viper.GetInt(key + ".burst")
+	}
+
+	return def
+}
+
+// Allow reports whether a request of client to roomID is allowed. An empty
+// roomID skips the room limit. Rejections are logged.
+func (p *Policy) Allow(client, roomID string) bool {
+	if !p.Client.Allow(client) {
+		slog.Warn("rate limited", "policy", p.Name, "scope", p.Scope, "client", client, "room_id", roomID)
+		return false
+	}
+
+	if len(roomID) != 0 && !p.Room.Allow(roomID) {
+		slog.Warn("rate limited", "policy", p.Name, "scope", "room", "client", client, "room_id", roomID)
+		return false
+	}
+
+	return true
+}
+
+// Middleware rejects the requests exceeding the policy with 429 Too Many Requests.
+// The client of the request is its IP. roomID extracts the room of the request,
+// it can be nil.
+func Middleware(p *Policy, roomID func(r *http.Request) string, fn func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var room string
+		if roomID != nil {
+			room = roomID(r)
+		}
+
+		if !p.Allow(ClientIP(r), room) {
+			retry := max(p.Client.RetryAfter(), p.Room.RetryAfter())
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())+1))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte("too many requests"))
+
+			return
+		}
+
+		fn(w, r)
+	}
+}
+
+// PathValue returns a roomID extractor reading the path value name.
+func PathValue(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.PathValue(name)
+	}
+}
+
+// ClientIP returns the IP of the client. X-Forwarded-For is read only when
+// rate_limit.trust_proxy is set, and only its rightmost entry: the one appended
+// by the proxy in front of the server. The entries left of it are sent by the
+// client and can be anything.
+func ClientIP(r *http.Request) string {
+	if viper.GetBool("rate_limit.trust_proxy") {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) != 0 {
+			forwarded := values[len(values)-1]
+			if i := strings.LastIndex(forwarded, ","); i >= 0 {
+				forwarded = forwarded[i+1:]
+			}
+
+			if ip := strings.TrimSpace(forwarded); len(ip) != 0 {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPolicyAllow(t *testing.T) {
+	p := NewPolicy("test_message", ScopePlayer, Limit{Rate: 1, Burst: 2}, Limit{Rate: 1, Burst: 5})
+
+	// HINT: players of one room share the room limit, not each other's limit.
+	for i, want := range []bool{true, true, false} {
+		if got := p.Allow("player:room/a", "room"); got != want {
+			t.Errorf("Allow(a) #%d = %v, want %v", i, got, want)
+		}
+	}
+
+	for i, want := range []bool{true, true, false} {
+		if got := p.Allow("player:room/b", "room"); got != want {
+			t.Errorf("Allow(b) #%d = %v, want %v", i, got, want)
+		}
+	}
+
+	if !p.Allow("player:other/a", "other") {
+		t.Error("Allow() of another room = false, want true")
+	}
+}
+
+func TestPolicyRoomLimit(t *testing.T) {
+	p := NewPolicy("test_join", ScopeIP, Limit{}, Limit{Rate: 1, Burst: 3})
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if p.Allow("10.0.0.1", "room") {
+			allowed++
+		}
+	}
+
+	if allowed != 3 {
+		t.Errorf("allowed = %d, want the room burst of 3", allowed)
+	}
+
+	if !p.Allow("10.0.0.1", "") {
+		t.Error("Allow() without a room = false, want true with no IP limit")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	defer viper.Reset()
+
+	tests := []struct {
+		name      string
+		trust     bool
+		forwarded []string
+		want      string
+	}{
+		{name: "no proxy", forwarded: []string{"1.2.3.4"}, want: "192.0.2.1"},
+		{name: "one hop", trust: true, forwarded: []string{"1.2.3.4"}, want: "1.2.3.4"},
+		{name: "spoofed hop", trust: true, forwarded: []string{"6.6.6.6, 1.2.3.4"}, want: "1.2.3.4"},
+		{name: "spoofed header", trust: true, forwarded: []string{"6.6.6.6", "1.2.3.4"}, want: "1.2.3.4"},
+		{name: "empty", trust: true, forwarded: []string{""}, want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("rate_limit.trust_proxy", tt.trust)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			if got := ClientIP(r); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
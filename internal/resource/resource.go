@@ -0,0 +1,14 @@
+package resource
+
+import (
+	"embed"
+)
+
+// FS holds the pages embedded into the binary.
+//
+//go:embed *.html
+var FS embed.FS
+
+// Dir is the folder of the resources on disk, relative to the repository root.
+// It's read instead of FS in dev mode.
+const Dir = "./internal/resource"
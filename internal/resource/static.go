@@ -0,0 +1,67 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sync"
+)
+
+// StaticPrefix is the route prefix of the static assets.
+const StaticPrefix = "/static/"
+
+const _hashLength = 12
+
+//go:embed static
+var _static embed.FS
+
+// Asset is an embedded static file and the hash of its content.
+type Asset struct {
+	Name string
+	Hash string
+	Body []byte
+}
+
+// Path returns the versioned path of the asset. The path changes with the content,
+// so it can be cached forever.
+func (a Asset) Path() string {
+	return StaticPrefix + a.Hash + "/" + a.Name
+}
+
+var _assets = sync.OnceValue(func() map[string]Asset {
+	assets := map[string]Asset{}
+	err := fs.WalkDir(_static, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		body, err := _static.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(body)
+		name := p[len("static/"):]
+		assets[name] = Asset{
+			Name: name,
+			Hash: hex.EncodeToString(sum[:])[:_hashLength],
+			Body: body,
+		}
+
+		return nil
+	})
+	if err != nil {
+		slog.Error("fs.WalkDir", "error", err)
+	}
+
+	return assets
+})
+
+// LoadAsset returns the embedded static file name, such as "vendor/axios.min.js".
+func LoadAsset(name string) (Asset, bool) {
+	asset, ok := _assets()[path.Clean(name)]
+	return asset, ok
+}
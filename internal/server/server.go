@@ -0,0 +1,58 @@
+// Package server registers the routes of the vote server, shared by the server
+// binary and the tools running it in-process.
+package server
+
+import (
+	"net/http"
+
+	"main/internal/controller/homepage"
+	"main/internal/controller/room"
+	"main/internal/controller/static"
+	"main/internal/logger"
+	"main/internal/metrics"
+	"main/internal/openapi"
+	"main/internal/ratelimit"
+	"main/internal/utils"
+)
+
+// Register registers every route of the server on mux. The rate limits are
+// read from the config when Register is called.
+func Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /metrics", metrics.Handler())
+
+	mux.HandleFunc("GET /static/{hash}/{path...}", static.Static())
+	mux.HandleFunc("GET /vote", utils.CORS(homepage.HomePage()))
+	mux.HandleFunc("GET /vote/{room_id}", utils.CORS(room.GetRoom()))
+	mux.HandleFunc("GET /vote/{room_id}/{uid}", utils.CORS(room.EnterRoom()))
+	mux.HandleFunc("GET /vote/{room_id}/login", utils.CORS(room.Login()))
+	mux.HandleFunc("GET /auth/callback", utils.CORS(room.LoginCallback()))
+
+	// HINT: the players of a room usually share the IP of the venue, so joins and
+	// upgrades are limited per room and messages per player.
+	createRoomLimit := ratelimit.NewPolicy("create_room", ratelimit.ScopeIP, ratelimit.Limit{Rate: 0.1, Burst: 5}, ratelimit.Limit{})
+	joinLimit := ratelimit.NewPolicy("join", ratelimit.ScopeIP, ratelimit.Limit{}, ratelimit.Limit{Rate: 20, Burst: 500})
+	upgradeLimit := ratelimit.NewPolicy("upgrade", ratelimit.ScopeIP, ratelimit.Limit{}, ratelimit.Limit{Rate: 50, Burst: 1000})
+	messageLimit := ratelimit.NewPolicy("message", ratelimit.ScopePlayer, ratelimit.Limit{Rate: 10, Burst: 30}, ratelimit.Limit{Rate: 500, Burst: 2000})
+	roomID := ratelimit.PathValue("room_id")
+
+	mux.HandleFunc("POST /api/vote/{room_id}", utils.CORS(ratelimit.Middleware(createRoomLimit, nil, room.CreateRoom())))
+	mux.HandleFunc("POST /api/vote/{room_id}/{uid}", utils.CORS(ratelimit.Middleware(joinLimit, roomID, room.CreatePlayer())))
+	mux.HandleFunc("GET /api/vote/{room_id}/receipts", utils.CORS(room.GetReceipts()))
+	mux.HandleFunc("GET /api/vote/{room_id}/export", utils.CORS(room.ExportResults()))
+	mux.HandleFunc("GET /api/vote/{room_id}/webhooks", utils.CORS(room.GetWebhooks()))
+
+	apiRoutes := room.APIRoutes(createRoomLimit)
+	for _, route := range apiRoutes {
+		mux.HandleFunc(route.Pattern(), utils.CORS(route.Handler))
+	}
+	mux.HandleFunc("GET /api/openapi.json", utils.CORS(openapi.Handler(room.APISpec(apiRoutes))))
+
+	// wss
+	mux.HandleFunc("/api/vote/{room_id}/{uid}/player", utils.CORS(ratelimit.Middleware(upgradeLimit, roomID, room.ConnectPlayer(messageLimit))))
+	mux.HandleFunc("/api/vote/{room_id}/{uid}/host", utils.CORS(ratelimit.Middleware(upgradeLimit, roomID, room.ConnectHost(messageLimit))))
+}
+
+// Handler wraps mux with the middlewares of every route.
+func Handler(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(logger.Middleware(utils.Preflight(mux).ServeHTTP))
+}
@@ -0,0 +1,250 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	_cookiePrefix         = "vote_session_"
+	_identityCookiePrefix = "vote_identity_"
+	_hostCookiePrefix     = "vote_host_"
+	_loginStateCookie     = "vote_login_state"
+	_hostPurpose          = "host"
+	_identityPurpose      = "identity"
+	_defaultMaxAge        = 24 * time.Hour
+)
+
+var (
+	_key     []byte
+	_keyOnce sync.Once
+)
+
+// key returns the signing key loaded from config. Without a configured secret a
+// random key is generated, so sessions do not survive a restart.
+func key() []byte {
+	_keyOnce.Do(func() {
+		secret := viper.GetString("session.secret")
+		if len(secret) != 0 {
+			_key = []byte(secret)
+			return
+		}
+
+		slog.Warn("session.secret is not set, use a random key")
+		_key = make([]byte, 32)
+		if _, err := rand.Read(_key); err != nil {
+			panic(err)
+		}
+	})
+
+	return _key
+}
+
+func maxAge() time.Duration {
+	if d := viper.GetDuration("session.max_age"); d > 0 {
+		return d
+	}
+
+	return _defaultMaxAge
+}
+
+// CookieName returns the name of the session cookie of the room.
+func CookieName(roomID string) string {
+	return _cookiePrefix + roomID
+}
+
+// Sign returns a token binding uid to the room until ttl elapses.
+func Sign(roomID, uid string, ttl time.Duration) string {
+	return sign("", roomID, uid, ttl)
+}
+
+// Parse verifies the token and returns the room and uid it binds.
+func Parse(token string) (roomID string, uid string, ok bool) {
+	return parse("", token)
+}
+
+// HostToken returns the token proving its bearer is the host of the room. It is
+// signed apart from the player sessions, so a player token is never a host token.
+func HostToken(roomID string) string {
+	return sign(_hostPurpose, roomID, roomID, maxAge())
+}
+
+// sign returns the token of the payload "len(roomID):roomID|uid|expiry". The
+// room ID is length-prefixed, so both it and uid may contain the separator.
+func sign(purpose, roomID, uid string, ttl time.Duration) string {
+	payload := strconv.Itoa(len(roomID)) + ":" + roomID + "|" + uid + "|" + strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac(purpose, payload))
+}
+
+func parse(purpose, token string) (roomID string, uid string, ok bool) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return "", "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sum, mac(purpose, string(payload))) {
+		return "", "", false
+	}
+
+	size, p, found := strings.Cut(string(payload), ":")
+	if !found {
+		return "", "", false
+	}
+
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 0 || n >= len(p) || p[n] != '|' {
+		return "", "", false
+	}
+
+	// HINT: the expiry has no separator, so uid ends at the last one.
+	roomID, rest := p[:n], p[n+1:]
+	last := strings.LastIndex(rest, "|")
+	if last < 0 {
+		return "", "", false
+	}
+
+	expiry, err := strconv.ParseInt(rest[last+1:], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return "", "", false
+	}
+
+	return roomID, rest[:last], true
+}
+
+// Issue sets the signed session cookie of uid in the room.
+func Issue(w http.ResponseWriter, roomID, uid string) {
+	setCookie(w, CookieName(roomID), roomID, uid)
+}
+
+// IssueIdentity sets the signed cookie of a subject verified by the identity
+// provider. It is signed apart from the player sessions, so a session token is
+// never an identity.
+func IssueIdentity(w http.ResponseWriter, roomID, subject string) {
+	setSignedCookie(w, _identityCookiePrefix+roomID, sign(_identityPurpose, roomID, subject, maxAge()))
+}
+
+// Identity returns the verified subject carried by the request for the room.
+func Identity(r *http.Request, roomID string) (string, bool) {
+	cookie, err := r.Cookie(_identityCookiePrefix + roomID)
+	if err != nil {
+		return "", false
+	}
+
+	cookieRoomID, subject, ok := parse(_identityPurpose, cookie.Value)
+	if !ok || cookieRoomID != roomID {
+		return "", false
+	}
+
+	return subject, true
+}
+
+// IssueHost sets the host cookie of the room.
+func IssueHost(w http.ResponseWriter, roomID string) {
+	setSignedCookie(w, _hostCookiePrefix+roomID, HostToken(roomID))
+}
+
+// VerifyHost reports whether the request carries the host token of the room,
+// either as a bearer token or as the host cookie.
+func VerifyHost(r *http.Request, roomID string) bool {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		cookie, err := r.Cookie(_hostCookiePrefix + roomID)
+		if err != nil {
+			return false
+		}
+
+		token = cookie.Value
+	}
+
+	tokenRoomID, uid, ok := parse(_hostPurpose, token)
+
+	return ok && tokenRoomID == roomID && uid == roomID
+}
+
+// IssueLoginState sets the cookie binding the login started with state to the
+// browser, until ttl elapses.
+func IssueLoginState(w http.ResponseWriter, state string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     _loginStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(viper.GetString("host"), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// VerifyLoginState reports whether the login of state was started by the
+// browser of the request, so a callback can't log in another browser.
+func VerifyLoginState(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(_loginStateCookie)
+	if err != nil || len(state) == 0 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) == 1
+}
+
+// ClearLoginState removes the login state cookie.
+func ClearLoginState(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: _loginStateCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+func setCookie(w http.ResponseWriter, name, roomID, uid string) {
+	setSignedCookie(w, name, Sign(roomID, uid, maxAge()))
+}
+
+func setSignedCookie(w http.ResponseWriter, name, token string) {
+	age := maxAge()
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(age.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(viper.GetString("host"), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Verify reports whether the request carries a valid session cookie of uid in the room.
+func Verify(r *http.Request, roomID, uid string) bool {
+	cookie, err := r.Cookie(CookieName(roomID))
+	if err != nil {
+		return false
+	}
+
+	cookieRoomID, cookieUID, ok := Parse(cookie.Value)
+
+	return ok && cookieRoomID == roomID && cookieUID == uid
+}
+
+// mac signs payload for purpose. Player sessions have no purpose, the other
+// tokens are signed with theirs, so a token never verifies as another kind.
+func mac(purpose, payload string) []byte {
+	h := hmac.New(sha256.New, key())
+	if len(purpose) != 0 {
+		h.Write([]byte(purpose + "\x00"))
+	}
+	h.Write([]byte(payload))
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,98 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func requestWithCookie(name, value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+
+	return r
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		roomID string
+		uid    string
+	}{
+		{name: "plain", roomID: "room", uid: "alice"},
+		{name: "separator in room ID", roomID: "ro|om", uid: "alice"},
+		{name: "separator in uid", roomID: "room", uid: "al|ice"},
+		{name: "separator in both", roomID: "|room|", uid: "|alice|"},
+		{name: "empty uid", roomID: "room"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roomID, uid, ok := Parse(Sign(tt.roomID, tt.uid, time.Hour))
+			if !ok || roomID != tt.roomID || uid != tt.uid {
+				t.Errorf("Parse() = %q, %q, %v, want %q, %q", roomID, uid, ok, tt.roomID, tt.uid)
+			}
+		})
+	}
+
+	if _, _, ok := Parse(Sign("room", "alice", -time.Hour)); ok {
+		t.Error("Parse() of an expired token = true, want false")
+	}
+
+	if !VerifyHost(requestWithCookie(_hostCookiePrefix+"ro|om", HostToken("ro|om")), "ro|om") {
+		t.Error("VerifyHost() of a room ID with a separator = false, want true")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	w := httptest.NewRecorder()
+	IssueIdentity(w, "room", "alice")
+	identity := w.Result().Cookies()[0].Value
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{name: "identity", token: identity, want: "alice"},
+		{name: "player session", token: Sign("room", "alice", time.Hour)},
+		{name: "host token", token: HostToken("room")},
+		{name: "other room", token: sign(_identityPurpose, "other", "alice", time.Hour)},
+		{name: "expired", token: sign(_identityPurpose, "room", "alice", -time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Identity(requestWithCookie(_identityCookiePrefix+"room", tt.token), "room")
+			if got != tt.want || ok != (len(tt.want) != 0) {
+				t.Errorf("Identity() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyLoginState(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		state  string
+		want   bool
+	}{
+		{name: "same state", cookie: "abc", state: "abc", want: true},
+		{name: "other state", cookie: "abc", state: "abd"},
+		{name: "empty state", cookie: "", state: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyLoginState(requestWithCookie(_loginStateCookie, tt.cookie), tt.state); got != tt.want {
+				t.Errorf("VerifyLoginState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if VerifyLoginState(httptest.NewRequest(http.MethodGet, "/", nil), "abc") {
+		t.Error("VerifyLoginState() without cookie = true, want false")
+	}
+}
@@ -2,19 +2,141 @@ package utils
 
 import (
 	"net/http"
+	"net/url"
+	"strings"
+
+	"main/internal/logger"
+
+	"github.com/spf13/viper"
 )
 
+const (
+	_allowMethods = "POST, GET, OPTIONS, PUT, DELETE"
+	_allowHeaders = "Accept, Content-Type, Content-Length, Accept-Encoding, Accept-Language, X-CSRF-Token, Authorization, Origin, Cache-Control, Pragma"
+	_preflightAge = "600"
+)
+
+// CORS sets the CORS headers for the allowed origins and rejects the requests
+// sent from any other origin with 403 Forbidden.
 func CORS(fn func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		SetCORS(w)
+		if !SetCORS(w, r) {
+			logger.FromContext(r.Context()).Warn("CORS, origin not allowed", "origin", r.Header.Get("Origin"), "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
 		fn(w, r)
 	})
 }
 
-func SetCORS(w http.ResponseWriter) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding,Accept-Language, X-CSRF-Token, Authorization, Connection, Host, Origin, User-Agent, Cookie, Upgrade, Sec_Websocket_Extensions, Sec-WebSocket-Key, Sec-WebSocket-Version, Sec-WebSocket-Protocol, Sec-WebSocket-Version, Pragma, Cache-Control")
+// Preflight answers the OPTIONS preflight requests of every route before they
+// reach the mux, which only knows the methods registered for each route.
+func Preflight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions || len(r.Header.Get("Access-Control-Request-Method")) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !SetCORS(w, r) {
+			logger.FromContext(r.Context()).Warn("Preflight, origin not allowed", "origin", r.Header.Get("Origin"), "path", r.URL.Path)
+			w.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		w.Header().Set("Access-Control-Max-Age", _preflightAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// SetCORS sets the CORS headers of the response, it reports false when the
+// origin of the request is not allowed.
+func SetCORS(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Origin")
+
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+
+	if !AllowOrigin(origin) {
+		return false
+	}
+
+	if allowAnyOrigin() {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	w.Header().Set("Access-Control-Allow-Methods", _allowMethods)
+	w.Header().Set("Access-Control-Allow-Headers", _allowHeaders)
+
+	return true
+}
+
+// AllowOrigin reports whether origin is in cors.allowed_origins. When the list
+// is not configured, only the origin of host is allowed. Requests without an
+// origin don't come from a browser and are always allowed.
+func AllowOrigin(origin string) bool {
+	if len(origin) == 0 {
+		return true
+	}
+
+	if allowAnyOrigin() {
+		return true
+	}
+
+	origin = normalizeOrigin(origin)
+	for _, allowed := range allowedOrigins() {
+		if normalizeOrigin(allowed) == origin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckOrigin is the origin check of the websocket upgrader.
+func CheckOrigin(r *http.Request) bool {
+	if AllowOrigin(r.Header.Get("Origin")) {
+		return true
+	}
+
+	logger.FromContext(r.Context()).Warn("CheckOrigin, origin not allowed", "origin", r.Header.Get("Origin"), "path", r.URL.Path)
+
+	return false
+}
+
+func allowedOrigins() []string {
+	if viper.IsSet("cors.allowed_origins") {
+		return viper.GetStringSlice("cors.allowed_origins")
+	}
+
+	return []string{viper.GetString("host")}
+}
+
+func allowAnyOrigin() bool {
+	for _, allowed := range allowedOrigins() {
+		if allowed == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeOrigin(origin string) string {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || len(u.Host) == 0 {
+		return strings.ToLower(strings.TrimSuffix(origin, "/"))
+	}
+
+	return strings.ToLower(u.Scheme + "://" + u.Host)
 }
 
 func SetWss(r *http.Request) {
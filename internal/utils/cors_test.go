@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// setOrigins configures host and, unless allowed is nil, cors.allowed_origins
+// for the test.
+func setOrigins(t *testing.T, allowed []string) {
+	t.Helper()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("host", "https://vote.example.com")
+	if allowed != nil {
+		viper.Set("cors.allowed_origins", allowed)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{name: "default host origin", origin: "https://vote.example.com", want: true},
+		{name: "default host origin, other case and slash", origin: "HTTPS://Vote.Example.com/", want: true},
+		{name: "default, other origin", origin: "https://evil.example.com"},
+		{name: "default, other scheme", origin: "http://vote.example.com"},
+		{name: "no origin", want: true},
+		{name: "listed origin", allowed: []string{"https://a.example.com", "https://b.example.com"}, origin: "https://b.example.com", want: true},
+		{name: "list replaces host", allowed: []string{"https://a.example.com"}, origin: "https://vote.example.com"},
+		{name: "any origin", allowed: []string{"*"}, origin: "https://evil.example.com", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOrigins(t, tt.allowed)
+
+			r := httptest.NewRequest(http.MethodGet, "/api/vote/room/uid/player", nil)
+			if len(tt.origin) != 0 {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if got := CheckOrigin(r); got != tt.want {
+				t.Errorf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowed         []string
+		origin          string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{name: "default host origin", origin: "https://vote.example.com", wantStatus: http.StatusNoContent, wantOrigin: "https://vote.example.com", wantCredentials: "true"},
+		{name: "rejected origin", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		// HINT: browsers refuse credentials with a wildcard origin, so none are allowed.
+		{name: "any origin", allowed: []string{"*"}, origin: "https://evil.example.com", wantStatus: http.StatusNoContent, wantOrigin: "*"},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOrigins(t, tt.allowed)
+
+			r := httptest.NewRequest(http.MethodOptions, "/api/rooms", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			w := httptest.NewRecorder()
+			Preflight(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+
+			if tt.wantStatus == http.StatusNoContent && w.Header().Get("Access-Control-Max-Age") != _preflightAge {
+				t.Errorf("Access-Control-Max-Age = %q, want %q", w.Header().Get("Access-Control-Max-Age"), _preflightAge)
+			}
+		})
+	}
+
+	t.Run("not a preflight", func(t *testing.T) {
+		setOrigins(t, nil)
+
+		r := httptest.NewRequest(http.MethodOptions, "/api/rooms", nil)
+		w := httptest.NewRecorder()
+		Preflight(next).ServeHTTP(w, r)
+
+		if w.Code != http.StatusTeapot {
+			t.Errorf("status = %d, want the next handler's %d", w.Code, http.StatusTeapot)
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	handler := CORS(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+	}{
+		{name: "host origin", origin: "https://vote.example.com", wantStatus: http.StatusOK},
+		{name: "rejected origin", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "no origin", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setOrigins(t, nil)
+
+			r := httptest.NewRequest(http.MethodGet, "/vote", nil)
+			if len(tt.origin) != 0 {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+
+			if w.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", w.Header().Get("Vary"))
+			}
+		})
+	}
+}
@@ -39,6 +39,21 @@ func (m *SyncMap[K, V]) Swap(key K, value V) (V, bool) {
 	return oldValue, exist
 }
 
+// LoadOrStore returns the existing value of the key if present, otherwise it stores the value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *SyncMap[K, V]) LoadOrStore(key K, value V) (actual V, loaded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.data[key]; ok {
+		return existing, true
+	}
+
+	m.data[key] = value
+
+	return value, false
+}
+
 func (m *SyncMap[K, V]) Store(key K, value V) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -41,3 +41,9 @@ func (v *SyncValue[T]) Swap(value T) T {
 
 	return old
 }
+
+func (v *SyncValue[T]) Exec(fn func(*T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fn(&v.value)
+}
@@ -0,0 +1,472 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"main/internal/metrics"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// Event is a room event a webhook subscribes to.
+type Event string
+
+const (
+	EventRoomCreated  Event = "room.created"
+	EventRoundStarted Event = "round.started"
+	EventRoundEnded   Event = "round.ended"
+	EventGameOver     Event = "game.over"
+	EventPlayerJoined Event = "player.joined"
+)
+
+// Events lists every event a webhook can subscribe to.
+var Events = []Event{EventRoomCreated, EventRoundStarted, EventRoundEnded, EventGameOver, EventPlayerJoined}
+
+const (
+	HeaderEvent     = "X-Vote-Event"
+	HeaderDelivery  = "X-Vote-Delivery"
+	HeaderTimestamp = "X-Vote-Timestamp"
+	HeaderSignature = "X-Vote-Signature"
+)
+
+var (
+	_defaultTimeout      = 5 * time.Second
+	_defaultMaxAttempts  = 5
+	_defaultBackoff      = time.Second
+	_defaultMaxBackoff   = time.Minute
+	_defaultQueueSize    = 100
+	_defaultLogSize      = 100
+	_defaultMaxEndpoints = 5
+
+	_workers sync.WaitGroup
+	_client  = sync.OnceValue(newClient)
+)
+
+var (
+	ErrTooManyEndpoints = errors.New("too many webhooks")
+	ErrPrivateAddress   = errors.New("webhook address is not public")
+)
+
+// Endpoint is a webhook of a room. An endpoint without events receives every event.
+type Endpoint struct {
+	URL    string  `json:"url"`
+	Secret string  `json:"secret,omitempty"`
+	Events []Event `json:"events,omitempty"`
+}
+
+// Validate checks the URL, secret and events of the endpoint.
+func (e Endpoint) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("invalid webhook url: %q", e.URL)
+	}
+
+	if len(e.Secret) == 0 {
+		return fmt.Errorf("webhook %s has no secret", u.Redacted())
+	}
+
+	for _, event := range e.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown webhook event: %q", event)
+		}
+	}
+
+	return nil
+}
+
+func (e Endpoint) wants(event Event) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, event)
+}
+
+// Validate checks the endpoints of a room.
+func Validate(endpoints []Endpoint) error {
+	if max := getInt("webhook.max_endpoints", _defaultMaxEndpoints); len(endpoints) > max {
+		return ErrTooManyEndpoints
+	}
+
+	for _, e := range endpoints {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Payload is the body posted to a webhook.
+type Payload struct {
+	ID        string `json:"id"`
+	Event     Event  `json:"event"`
+	RoomID    string `json:"room_id"`
+	Timestamp int64  `json:"timestamp"`
+	Data      any    `json:"data"`
+}
+
+// Delivery is an attempt to post a payload, kept in the delivery log of the room.
+// Endpoint is the index of the webhook in the room, URL only names its host.
+type Delivery struct {
+	ID         string `json:"id"`
+	Event      Event  `json:"event"`
+	Endpoint   int    `json:"endpoint"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Delivered  bool   `json:"delivered"`
+	DurationMs int64  `json:"duration_ms"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// Sign returns the signature of a payload sent at timestamp, the hex encoded
+// HMAC-SHA256 of "<timestamp>.<body>" keyed by the secret of the webhook.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the request carries a valid signature of body. Receivers
+// should also reject timestamps too far in the past.
+func Verify(secret string, r *http.Request, body []byte) bool {
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(r.Header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body)))
+}
+
+// Dispatcher posts the events of a room to its webhooks. Every webhook has its
+// own queue, so a slow receiver does not hold the others back. A nil
+// Dispatcher drops every event.
+type Dispatcher struct {
+	l       *slog.Logger
+	roomID  string
+	workers []*worker
+
+	mu      sync.Mutex
+	log     []Delivery
+	logSize int
+
+	queueMu sync.RWMutex
+	closed  bool
+}
+
+type worker struct {
+	Endpoint
+	index int
+	queue chan *Payload
+}
+
+// New starts the workers of the endpoints, it returns nil without endpoints.
+func New(l *slog.Logger, roomID string, endpoints []Endpoint) *Dispatcher {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	d := &Dispatcher{
+		l:       l,
+		roomID:  roomID,
+		logSize: getInt("webhook.log_size", _defaultLogSize),
+	}
+
+	queueSize := getInt("webhook.queue_size", _defaultQueueSize)
+	for i, e := range endpoints {
+		w := &worker{Endpoint: e, index: i, queue: make(chan *Payload, queueSize)}
+		d.workers = append(d.workers, w)
+
+		_workers.Add(1)
+		go d.run(w)
+	}
+
+	return d
+}
+
+// Fire queues event for the webhooks subscribing to it. It never blocks, the
+// event is dropped for a webhook whose queue is full.
+func (d *Dispatcher) Fire(event Event, data any) {
+	if d == nil {
+		return
+	}
+
+	p := &Payload{
+		ID:        uuid.NewString(),
+		Event:     event,
+		RoomID:    d.roomID,
+		Timestamp: time.Now().UnixMilli(),
+		Data:      data,
+	}
+
+	d.queueMu.RLock()
+	defer d.queueMu.RUnlock()
+
+	if d.closed {
+		return
+	}
+
+	for i, w := range d.workers {
+		if !w.wants(event) {
+			continue
+		}
+
+		select {
+		case w.queue <- p:
+		default:
+			d.l.Warn("webhook queue full, drop event", "event", event, "endpoint", i, "url", redact(w.URL))
+			metrics.WebhookDeliveries.WithLabelValues(string(event), "dropped").Inc()
+			d.record(Delivery{ID: p.ID, Event: event, Endpoint: i, URL: redact(w.URL), Error: "queue full", Timestamp: time.Now().UnixMilli()})
+		}
+	}
+}
+
+// Close stops accepting events. The queued events are still delivered.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+
+	d.queueMu.Lock()
+	defer d.queueMu.Unlock()
+
+	if d.closed {
+		return
+	}
+
+	d.closed = true
+	for _, w := range d.workers {
+		close(w.queue)
+	}
+}
+
+// Endpoints returns the webhooks of the room, with their secrets removed and
+// their URLs reduced to the host.
+func (d *Dispatcher) Endpoints() []Endpoint {
+	if d == nil {
+		return []Endpoint{}
+	}
+
+	endpoints := make([]Endpoint, 0, len(d.workers))
+	for _, w := range d.workers {
+		endpoints = append(endpoints, Endpoint{URL: redact(w.URL), Events: w.Events})
+	}
+
+	return endpoints
+}
+
+// Deliveries returns the delivery log, oldest first.
+func (d *Dispatcher) Deliveries() []Delivery {
+	if d == nil {
+		return []Delivery{}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.Clone(d.log)
+}
+
+// Wait waits for the queued events of every closed dispatcher to be delivered,
+// or for ctx to be done.
+func Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		_workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+}
+
+func (d *Dispatcher) run(w *worker) {
+	defer _workers.Done()
+	for p := range w.queue {
+		d.deliver(w, p)
+	}
+}
+
+// deliver posts p to the webhook, retrying with exponential backoff and jitter
+// while the receiver fails with a network error, 429 or 5xx.
+func (d *Dispatcher) deliver(w *worker, p *Payload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		d.l.Error("json.Marshal", "error", err, "event", p.Event)
+		return
+	}
+
+	maxAttempts := getInt("webhook.max_attempts", _defaultMaxAttempts)
+	backoff := getDuration("webhook.backoff", _defaultBackoff)
+	maxBackoff := getDuration("webhook.max_backoff", _defaultMaxBackoff)
+	l := d.l.With("event", p.Event, "delivery", p.ID, "endpoint", w.index, "url", redact(w.URL))
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, err := post(w.Endpoint, p, body)
+		delivery := Delivery{
+			ID:         p.ID,
+			Event:      p.Event,
+			Endpoint:   w.index,
+			URL:        redact(w.URL),
+			Attempt:    attempt,
+			StatusCode: status,
+			Delivered:  err == nil && status >= 200 && status < 300,
+			DurationMs: time.Since(start).Milliseconds(),
+			Timestamp:  start.UnixMilli(),
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		d.record(delivery)
+		if delivery.Delivered {
+			l.Debug("webhook delivered", "attempt", attempt, "status", status)
+			metrics.WebhookDeliveries.WithLabelValues(string(p.Event), "delivered").Inc()
+
+			return
+		}
+
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt >= maxAttempts {
+			l.Warn("webhook failed", "attempt", attempt, "status", status, "error", delivery.Error)
+			metrics.WebhookDeliveries.WithLabelValues(string(p.Event), "failed").Inc()
+
+			return
+		}
+
+		metrics.WebhookDeliveries.WithLabelValues(string(p.Event), "retried").Inc()
+		wait := backoff
+		for i := 1; i < attempt && wait < maxBackoff; i++ {
+			wait *= 2
+		}
+		wait = min(wait, maxBackoff)
+		time.Sleep(wait/2 + rand.N(wait/2+1))
+	}
+}
+
+func post(e Endpoint, p *Payload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "vote-webhook/1")
+	req.Header.Set(HeaderEvent, string(p.Event))
+	req.Header.Set(HeaderDelivery, p.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(e.Secret, timestamp, body))
+
+	resp, err := _client().Do(req)
+	if err != nil {
+		// HINT: drop the URL from the error, it may carry the token of the webhook.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) record(delivery Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.log = append(d.log, delivery)
+	if over := len(d.log) - d.logSize; over > 0 {
+		d.log = slices.Delete(d.log, 0, over)
+	}
+}
+
+// newClient returns the client posting the webhooks. It does not follow
+// redirects, and unless webhook.allow_private_networks is set, it refuses to
+// connect to loopback, private and link-local addresses, so room owners can't
+// reach the internal network through a webhook.
+func newClient() *http.Client {
+	allowPrivate := viper.GetBool("webhook.allow_private_networks")
+	dialer := &net.Dialer{
+		Timeout: getDuration("webhook.timeout", _defaultTimeout),
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   getDuration("webhook.timeout", _defaultTimeout),
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// redact reduces a webhook URL to its scheme and host, chat webhooks often carry
+// their token in the path or query.
+func redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Scheme + "://" + u.Host
+}
+
+func getInt(key string, fallback int) int {
+	if n := viper.GetInt(key); n > 0 {
+		return n
+	}
+
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if d := viper.GetDuration(key); d > 0 {
+		return d
+	}
+
+	return fallback
+}
@@ -0,0 +1,236 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const _testSecret = "webhook-secret"
+
+// setConfig sets the webhook config of the test and rebuilds the client, which
+// reads webhook.allow_private_networks once.
+func setConfig(t *testing.T, allowPrivate bool) {
+	t.Helper()
+
+	viper.Reset()
+	viper.Set("webhook.allow_private_networks", allowPrivate)
+	viper.Set("webhook.backoff", time.Millisecond)
+	viper.Set("webhook.max_backoff", 5*time.Millisecond)
+	viper.Set("webhook.max_attempts", 3)
+	_client = sync.OnceValue(newClient)
+
+	t.Cleanup(func() {
+		viper.Reset()
+		_client = sync.OnceValue(newClient)
+	})
+}
+
+// deliver fires event to a dispatcher of url and returns its delivery log once
+// the event is delivered or given up.
+func deliver(t *testing.T, url string) []Delivery {
+	t.Helper()
+
+	d := New(slog.Default(), "room", []Endpoint{{URL: url, Secret: _testSecret}})
+	d.Fire(EventRoundStarted, map[string]int{"round": 1})
+	d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	Wait(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("Wait() timed out")
+	}
+
+	return d.Deliveries()
+}
+
+// receiver replies the statuses in order, then 200, and counts the requests.
+func receiver(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &requests
+}
+
+func TestSignature(t *testing.T) {
+	setConfig(t, true)
+
+	type received struct {
+		valid, wrongSecret bool
+		payload            Payload
+		event              string
+	}
+
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p Payload
+		json.Unmarshal(body, &p)
+		got <- received{
+			valid:       Verify(_testSecret, r, body),
+			wrongSecret: Verify("other", r, body),
+			payload:     p,
+			event:       r.Header.Get(HeaderEvent),
+		}
+	}))
+	defer srv.Close()
+
+	deliveries := deliver(t, srv.URL+"/hook?token=abc")
+	r := <-got
+	if !r.valid {
+		t.Error("Verify() with the secret = false, want true")
+	}
+
+	if r.wrongSecret {
+		t.Error("Verify() with another secret = true, want false")
+	}
+
+	if r.payload.Event != EventRoundStarted || r.payload.RoomID != "room" || r.event != string(EventRoundStarted) {
+		t.Errorf("payload = %+v, event header %q", r.payload, r.event)
+	}
+
+	if len(deliveries) != 1 || !deliveries[0].Delivered || deliveries[0].ID != r.payload.ID {
+		t.Fatalf("deliveries = %+v, want one delivered", deliveries)
+	}
+
+	// HINT: the log names only the host, the token of the URL is kept out.
+	if strings.Contains(deliveries[0].URL, "token") || deliveries[0].URL != srv.URL {
+		t.Errorf("delivery URL = %q, want %q", deliveries[0].URL, srv.URL)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	body := []byte(`{"event":"game.over"}`)
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(HeaderTimestamp, "1700000000")
+	r.Header.Set(HeaderSignature, Sign(_testSecret, 1700000000, body))
+
+	if !Verify(_testSecret, r, body) {
+		t.Fatal("Verify() = false, want true")
+	}
+
+	if Verify(_testSecret, r, []byte(`{"event":"round.started"}`)) {
+		t.Error("Verify() of another body = true, want false")
+	}
+
+	r.Header.Set(HeaderTimestamp, "1700000001")
+	if Verify(_testSecret, r, body) {
+		t.Error("Verify() of another timestamp = true, want false")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantRequests int32
+		wantOK       bool
+	}{
+		{name: "5xx is retried", statuses: []int{500, 503}, wantRequests: 3, wantOK: true},
+		{name: "429 is retried", statuses: []int{429}, wantRequests: 2, wantOK: true},
+		{name: "4xx is not retried", statuses: []int{400}, wantRequests: 1},
+		{name: "redirect is not followed", statuses: []int{302}, wantRequests: 1},
+		{name: "gives up after max attempts", statuses: []int{500, 500, 500, 500}, wantRequests: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, true)
+			srv, requests := receiver(t, tt.statuses...)
+
+			deliveries := deliver(t, srv.URL)
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+
+			if len(deliveries) != int(tt.wantRequests) {
+				t.Fatalf("deliveries = %d, want one per request", len(deliveries))
+			}
+
+			for i, d := range deliveries {
+				if d.Attempt != i+1 {
+					t.Errorf("delivery %d attempt = %d, want %d", i, d.Attempt, i+1)
+				}
+
+				if i < len(tt.statuses) && d.StatusCode != tt.statuses[i] {
+					t.Errorf("delivery %d status = %d, want %d", i, d.StatusCode, tt.statuses[i])
+				}
+			}
+
+			if last := deliveries[len(deliveries)-1]; last.Delivered != tt.wantOK {
+				t.Errorf("delivered = %v, want %v", last.Delivered, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDeliveryLogSize(t *testing.T) {
+	setConfig(t, true)
+	viper.Set("webhook.log_size", 2)
+	srv, _ := receiver(t, 500, 500, 500)
+
+	deliveries := deliver(t, srv.URL)
+	if len(deliveries) != 2 || deliveries[0].Attempt != 2 || deliveries[1].Attempt != 3 {
+		t.Errorf("deliveries = %+v, want the last 2 attempts", deliveries)
+	}
+}
+
+func TestPrivateAddressBlocked(t *testing.T) {
+	setConfig(t, false)
+	srv, requests := receiver(t)
+
+	deliveries := deliver(t, srv.URL)
+	if requests.Load() != 0 {
+		t.Errorf("requests = %d, want none to a loopback receiver", requests.Load())
+	}
+
+	if len(deliveries) == 0 || deliveries[0].Delivered || !strings.Contains(deliveries[0].Error, ErrPrivateAddress.Error()) {
+		t.Errorf("deliveries = %+v, want %q", deliveries, ErrPrivateAddress)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	viper.Reset()
+
+	tests := []struct {
+		name      string
+		endpoints []Endpoint
+		wantErr   bool
+	}{
+		{name: "valid", endpoints: []Endpoint{{URL: "https://example.com/hook", Secret: "s", Events: []Event{EventGameOver}}}},
+		{name: "no secret", endpoints: []Endpoint{{URL: "https://example.com/hook"}}, wantErr: true},
+		{name: "bad scheme", endpoints: []Endpoint{{URL: "ftp://example.com/hook", Secret: "s"}}, wantErr: true},
+		{name: "unknown event", endpoints: []Endpoint{{URL: "https://example.com/hook", Secret: "s", Events: []Event{"room.deleted"}}}, wantErr: true},
+		{name: "too many", endpoints: make([]Endpoint, _defaultMaxEndpoints+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.endpoints); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
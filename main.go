@@ -1,32 +1,91 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"main/internal/controller/homepage"
+	"main/internal/audit"
 	"main/internal/controller/room"
-	"main/internal/utils"
+	"main/internal/logger"
+	"main/internal/page"
+	"main/internal/server"
+	"main/internal/webhook"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
 	"github.com/yanun0323/pkg/config"
 )
 
+const _defaultShutdownTimeout = 10 * time.Second
+
 func main() {
 	if err := config.Init("config", true); err != nil {
 		slog.Error("config.Init", "err", err.Error())
 	}
 
-	http.HandleFunc("GET /vote", utils.CORS(homepage.HomePage()))
-	http.HandleFunc("GET /vote/{room_id}", utils.CORS(room.GetRoom()))
-	http.HandleFunc("GET /vote/{room_id}/{uid}", utils.CORS(room.EnterRoom()))
+	if err := logger.Init(); err != nil {
+		slog.Error("logger.Init", "err", err.Error())
+		os.Exit(1)
+	}
 
-	http.HandleFunc("POST /api/vote/{room_id}", utils.CORS(room.CreateRoom()))
-	http.HandleFunc("POST /api/vote/{room_id}/{uid}", utils.CORS(room.CreatePlayer()))
+	if err := audit.Init(); err != nil {
+		slog.Error("audit.Init", "err", err.Error())
+		os.Exit(1)
+	}
+
+	if err := page.Init(); err != nil {
+		slog.Error("page.Init", "err", err.Error())
+		os.Exit(1)
+	}
 
-	// wss
-	http.HandleFunc("/api/vote/{room_id}/{uid}/player", utils.CORS(room.ConnectPlayer()))
-	http.HandleFunc("/api/vote/{room_id}/{uid}/host", utils.CORS(room.ConnectHost()))
+	prometheus.MustRegister(room.NewCollector())
+	server.Register(http.DefaultServeMux)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go room.RunJanitor(ctx)
 
 	// listen on port 8080
-	http.ListenAndServe(":8080", nil)
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: server.Handler(http.DefaultServeMux),
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server.ListenAndServe", "err", err.Error())
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	timeout := viper.GetDuration("server.shutdown_timeout")
+	if timeout <= 0 {
+		timeout = _defaultShutdownTimeout
+	}
+
+	slog.Info("shutting down", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	room.Drain(shutdownCtx)
+	webhook.Wait(shutdownCtx)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("server.Shutdown", "err", err.Error())
+	}
+
+	if err := audit.Default().Close(); err != nil {
+		slog.Error("audit.Close", "err", err.Error())
+	}
+
+	slog.Info("server stopped")
 }